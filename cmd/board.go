@@ -0,0 +1,117 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/mholt/archiver"
+	"github.com/xoviat/jcad/lib"
+)
+
+/*
+the names of the files generated for a board
+*/
+type boardFiles struct {
+	Name      string
+	POS       string
+	BOM       string
+	CPL       string
+	Consigned string
+	Hand      string
+	Cart      string
+	Gerbers   string
+	ZIP       string
+}
+
+func newBoardFiles(pcb string, output lib.OutputConfig) boardFiles {
+	rname := strings.TrimSuffix(filepath.Base(pcb), path.Ext(pcb))
+	names := output.Expand(rname)
+
+	return boardFiles{
+		Name:      rname,
+		POS:       filepath.Join(filepath.Dir(pcb), rname+"-data.pos"),
+		BOM:       filepath.Join(filepath.Dir(pcb), names.BOM),
+		CPL:       filepath.Join(filepath.Dir(pcb), names.CPL),
+		Consigned: filepath.Join(filepath.Dir(pcb), names.Consigned),
+		Hand:      filepath.Join(filepath.Dir(pcb), names.Hand),
+		Cart:      filepath.Join(filepath.Dir(pcb), names.Cart),
+		Gerbers:   filepath.Join(filepath.Dir(pcb), names.Gerbers),
+		ZIP:       filepath.Join(filepath.Dir(pcb), names.ZIP),
+	}
+}
+
+/*
+export the gerbers, drill and position files for a board
+*/
+func exportBoard(kicad *lib.KiCadInterface, pcb string, filenames boardFiles) {
+	os.RemoveAll(filenames.Gerbers)
+	os.MkdirAll(filenames.Gerbers, 0777)
+
+	kicad.ExecuteCommand(
+		[]string{
+			"pcb", "export", "gerbers", filepath.Join("..", filepath.Base(pcb)),
+		}, filenames.Gerbers,
+	)
+	kicad.ExecuteCommand(
+		[]string{
+			"pcb", "export", "drill", filepath.Join("..", filepath.Base(pcb)),
+		}, filenames.Gerbers,
+	)
+	exportPOS(kicad, pcb, filenames)
+}
+
+/*
+export only the position file for a board
+*/
+func exportPOS(kicad *lib.KiCadInterface, pcb string, filenames boardFiles) {
+	kicad.ExecuteCommand(
+		[]string{
+			"pcb", "export", "pos", filepath.Base(pcb),
+			"--output", filenames.POS,
+			"--units", "mm",
+			"--format", "csv",
+		}, filepath.Dir(pcb),
+	)
+}
+
+/*
+write the upload files for a board: the BOM, CPL, gerber archive and, if
+present, the consigned BOM, hand-solder BOM and LCSC cart
+*/
+func writeBoardFiles(
+	filenames boardFiles, bom lib.BOM, consigned lib.ConsignedBOM, hand lib.HandBOM, placed []*lib.BoardComponent,
+) {
+	lib.WriteBOM(filenames.BOM, bom)
+	lib.WriteCPL(filenames.CPL, placed)
+
+	os.Remove(filenames.Consigned)
+	if len(consigned) > 0 {
+		lib.WriteConsignedBOM(filenames.Consigned, consigned)
+	}
+
+	os.Remove(filenames.Hand)
+	os.Remove(filenames.Cart)
+	if len(hand) > 0 {
+		lib.WriteHandBOM(filenames.Hand, hand)
+		lib.WriteLCSCCart(filenames.Cart, hand)
+	}
+
+	os.Remove(filenames.ZIP)
+	archiver.Archive([]string{filenames.Gerbers}, filenames.ZIP)
+}
+
+/*
+return an association map that checks the project associations of a
+board before the library
+*/
+func newAssociationMap(library *lib.Library, pcb string) (*lib.AssocationMap, error) {
+	project, err := lib.LoadProjectAssociations(lib.ProjectAssociationsPath(pcb))
+	if err != nil {
+		return nil, fmt.Errorf("failed to load project associations: %s", err)
+	}
+
+	return lib.NewProjectAssociationMap(library, project), nil
+}
@@ -0,0 +1,35 @@
+/*
+Copyright © 2023 NAME HERE <EMAIL ADDRESS>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cmd
+
+import (
+	"github.com/spf13/cobra"
+)
+
+// bomCmd represents the bom command
+var bomCmd = &cobra.Command{
+	Use:   "bom",
+	Short: "Work with the bill of materials of one or more boards.",
+	Long: `Work with the bill of materials of one or more boards.
+
+	Example:
+		- jcad bom merge <a.kicad_pcb> <b.kicad_pcb> --qty 10,5
+		- jcad bom consolidate <file.kicad_pcb>`,
+}
+
+func init() {
+	rootCmd.AddCommand(bomCmd)
+}
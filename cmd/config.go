@@ -0,0 +1,87 @@
+package cmd
+
+import (
+	"os"
+
+	"github.com/spf13/cobra"
+	"github.com/xoviat/jcad/lib"
+)
+
+/*
+return the configuration for a board: the user configuration, the project
+configuration beside the board, the environment and then the flags
+
+pcb may be empty if the command does not operate on a board
+*/
+func loadConfig(cmd *cobra.Command, pcb string) (*lib.Config, error) {
+	config := lib.DefaultConfig()
+	paths := []string{lib.UserConfigPath()}
+	if cfgFile != "" {
+		/* unlike the user and project configurations, a configuration given by name must exist */
+		if err := config.Load(cfgFile); err != nil {
+			return nil, err
+		}
+		paths = nil
+	}
+
+	if pcb != "" {
+		paths = append(paths, lib.ProjectConfigPath(pcb))
+	}
+
+	for _, path := range paths {
+		if err := config.Load(path); err != nil && !os.IsNotExist(err) {
+			return nil, err
+		}
+	}
+
+	if err := config.ApplyEnv(os.LookupEnv); err != nil {
+		return nil, err
+	}
+
+	if libraryPath != "" {
+		config.Library = libraryPath
+	}
+
+	if kicadPath != "" {
+		config.KiCad = kicadPath
+	}
+
+	if flag := cmd.Flags().Lookup("connectors"); flag != nil && flag.Changed {
+		config.Connectors = connectors
+	}
+
+	if flag := cmd.Flags().Lookup("offline"); flag != nil && flag.Changed {
+		config.Offline = offline
+	}
+
+	return config, nil
+}
+
+/*
+return the source of JLCPCB parts for the configuration
+
+offline, parts are looked up in the library, which may be nil, and the cache
+*/
+func newComponentSource(config *lib.Config, library *lib.Library) lib.ComponentSource {
+	if config.Offline {
+		return lib.NewOfflineSource(library, jlcConfig(config))
+	}
+
+	return newJLC(config)
+}
+
+/*
+return the JLCPCB client for the configuration, regardless of whether jcad is offline
+*/
+func newJLC(config *lib.Config) *lib.JLC {
+	return lib.NewConfiguredJLC(jlcConfig(config))
+}
+
+func jlcConfig(config *lib.Config) lib.JLCConfig {
+	jlc := config.JLC
+	if jlc.Cache == "" {
+		jlc.Cache = lib.DefaultCachePath()
+	}
+
+	return jlc
+}
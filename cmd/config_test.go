@@ -0,0 +1,26 @@
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestLoadConfigFlag(t *testing.T) {
+	previous := cfgFile
+	defer func() { cfgFile = previous }()
+
+	/* a typo in the path given with --config is not ignored */
+	cfgFile = filepath.Join(t.TempDir(), "missing.yaml")
+	if _, err := loadConfig(refreshCmd, ""); !os.IsNotExist(err) {
+		t.Errorf("expected the missing configuration to be an error, got %v", err)
+	}
+
+	if err := os.WriteFile(cfgFile, []byte("connectors: true\n"), 0666); err != nil {
+		t.Fatal(err)
+	}
+
+	if config, err := loadConfig(refreshCmd, ""); err != nil || !config.Connectors {
+		t.Errorf("expected the configuration to be loaded, got %+v %v", config, err)
+	}
+}
@@ -0,0 +1,136 @@
+/*
+Copyright © 2023 NAME HERE <EMAIL ADDRESS>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cmd
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"github.com/xoviat/jcad/lib"
+)
+
+var ctolerance float64
+
+// consolidateCmd represents the bom consolidate command
+var consolidateCmd = &cobra.Command{
+	Use:   "consolidate",
+	Short: "Find BOM lines with near-equal values that could be merged.",
+	Long: `Consolidate groups the resistors, capacitors and inductors of a BOM by
+	package and finds lines with near-equal values. For each group, the
+	number of unique lines that could be removed and the basic part that
+	would cover them are shown.
+
+	The BOM is either a KiCad board, which is resolved through the library,
+	or a previously generated BOM file, which is recognised by the BOM
+	output name of the configuration.
+
+	Example:
+		- jcad bom consolidate <file.kicad_pcb>
+		- jcad bom consolidate --tolerance 0.05 <file-BOM.csv>`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		config, err := loadConfig(cmd, args[0])
+		if err != nil {
+			fmt.Printf("failed to load configuration: %s\n", err)
+			return
+		}
+
+		library, err := lib.NewConfiguredLibrary(config, true)
+		if err != nil {
+			fmt.Printf("failed to obtain default library: %s\n", err)
+			return
+		}
+		defer library.Close()
+
+		var bom lib.BOM
+		if _, ok := lib.MatchOutput(config.Output.BOM, filepath.Base(args[0])); ok {
+			if bom, err = lib.ReadBOM(args[0]); err != nil {
+				fmt.Printf("failed to read bom: %s\n", err)
+				return
+			}
+
+			for _, entry := range bom {
+				entry.Component = library.Exact(entry.Component.CID())
+			}
+		} else {
+			pcb, err := lib.NormalizePCB(args[0])
+			if err != nil {
+				fmt.Println(err.Error())
+				return
+			}
+
+			kicad, err := lib.NewConfiguredKicadInterface(config)
+			if err != nil {
+				fmt.Printf("failed to obtain kicad instance: %s\n", err)
+				return
+			}
+
+			assocations, err := newAssociationMap(library, pcb)
+			if err != nil {
+				fmt.Println(err.Error())
+				return
+			}
+
+			filenames := newBoardFiles(pcb, config.Output)
+			exportPOS(kicad, pcb, filenames)
+
+			board := lib.ResolveBoard(
+				pcb, filenames.Name, 1, lib.ReadPOS(filenames.POS), assocations,
+			)
+			bom = board.BOM
+		}
+
+		groups := lib.ConsolidateBOM(bom, library.BasicComponents(), ctolerance)
+		if len(groups) == 0 {
+			fmt.Println("no BOM lines could be consolidated")
+			return
+		}
+
+		removable := 0
+		for _, group := range groups {
+			lines := []string{}
+			for _, line := range group.Lines {
+				lines = append(lines, fmt.Sprintf(
+					"%s x%d (%s)", line.Entry.Comment, len(line.Entry.Designators),
+					strings.Join(line.Entry.Designators, ","),
+				))
+			}
+
+			fmt.Printf("%s %s: %d lines could be replaced by one\n", group.Prefix, group.Package, len(group.Lines))
+			fmt.Printf("  %s\n", strings.Join(lines, "\n  "))
+			if group.Suggested != nil {
+				fmt.Printf("  suggested basic part: %s (%s, %s)\n",
+					group.Suggested.CID(), group.Suggested.Value(), group.Suggested.Description,
+				)
+			} else {
+				fmt.Println("  no basic part covers this group")
+			}
+
+			removable += group.Removable()
+		}
+
+		fmt.Printf("%d unique BOM lines could be removed\n", removable)
+	},
+}
+
+func init() {
+	bomCmd.AddCommand(consolidateCmd)
+
+	consolidateCmd.Flags().Float64VarP(&ctolerance, "tolerance", "t", 0.1, "relative difference between values to group")
+	consolidateCmd.Flags().BoolVarP(&connectors, "connectors", "", false, "whether to assemble connectors")
+}
@@ -0,0 +1,151 @@
+/*
+Copyright © 2023 NAME HERE <EMAIL ADDRESS>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"github.com/xoviat/jcad/lib"
+)
+
+var djson bool
+
+// diffCmd represents the diff command
+var diffCmd = &cobra.Command{
+	Use:   "diff",
+	Short: "Compare the assembly of two board revisions.",
+	Long: `Diff compares the assembly of two board revisions and reports added and
+	removed designators, changed parts, moved and rotated components and
+	BOM line changes.
+
+	Each revision is either a KiCad board, which is resolved through the
+	library, or a previously generated BOM or CPL file. When a BOM or CPL
+	file is given, the other files of the set are found next to it, using
+	the output names of the configuration.
+
+	Example:
+		- jcad diff <old.kicad_pcb> <new.kicad_pcb>
+		- jcad diff <old-BOM.csv> <new.kicad_pcb>
+		- jcad diff --json <old-all-pos.csv> <new-all-pos.csv>`,
+	Args: cobra.ExactArgs(2),
+	Run: func(cmd *cobra.Command, args []string) {
+		var (
+			library *lib.Library
+			kicad   *lib.KiCadInterface
+		)
+
+		load := func(src string) (lib.Assembly, error) {
+			if !strings.HasSuffix(src, ".kicad_pcb") {
+				return loadGenerated(cmd, src)
+			}
+
+			pcb, err := lib.NormalizePCB(src)
+			if err != nil {
+				return nil, err
+			}
+
+			config, err := loadConfig(cmd, pcb)
+			if err != nil {
+				return nil, fmt.Errorf("failed to load configuration: %s", err)
+			}
+
+			if library == nil {
+				if library, err = lib.NewConfiguredLibrary(config, true); err != nil {
+					return nil, fmt.Errorf("failed to obtain default library: %s", err)
+				}
+			}
+
+			if kicad == nil {
+				if kicad, err = lib.NewConfiguredKicadInterface(config); err != nil {
+					return nil, fmt.Errorf("failed to obtain kicad instance: %s", err)
+				}
+			}
+
+			assocations, err := newAssociationMap(library, pcb)
+			if err != nil {
+				return nil, err
+			}
+
+			filenames := newBoardFiles(pcb, config.Output)
+			exportPOS(kicad, pcb, filenames)
+
+			return lib.NewAssembly(lib.ReadPOS(filenames.POS), assocations), nil
+		}
+
+		defer func() {
+			if library != nil {
+				library.Close()
+			}
+		}()
+
+		before, err := load(args[0])
+		if err != nil {
+			fmt.Printf("failed to load %s: %s\n", args[0], err)
+			return
+		}
+
+		after, err := load(args[1])
+		if err != nil {
+			fmt.Printf("failed to load %s: %s\n", args[1], err)
+			return
+		}
+
+		diff := lib.DiffAssembly(before, after)
+		if djson {
+			enc := json.NewEncoder(os.Stdout)
+			enc.SetIndent("", "  ")
+			if err := enc.Encode(diff); err != nil {
+				fmt.Printf("failed to encode diff: %s\n", err)
+			}
+
+			return
+		}
+
+		diff.WriteText(os.Stdout)
+	},
+}
+
+/*
+read the assembly from a generated BOM or CPL file and the other files of
+its set, which are named by the output configuration of the board
+*/
+func loadGenerated(cmd *cobra.Command, src string) (lib.Assembly, error) {
+	config, err := loadConfig(cmd, src)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load configuration: %s", err)
+	}
+
+	for _, template := range []string{config.Output.BOM, config.Output.CPL} {
+		if name, ok := lib.MatchOutput(template, filepath.Base(src)); ok {
+			filenames := newBoardFiles(filepath.Join(filepath.Dir(src), name+".kicad_pcb"), config.Output)
+			return lib.ReadAssembly(filenames.BOM, filenames.CPL, filenames.Consigned)
+		}
+	}
+
+	return nil, fmt.Errorf("not a board or a generated BOM or CPL file: %s", src)
+}
+
+func init() {
+	rootCmd.AddCommand(diffCmd)
+
+	diffCmd.Flags().BoolVarP(&djson, "json", "", false, "write the differences as JSON")
+	diffCmd.Flags().BoolVarP(&connectors, "connectors", "", false, "whether to assemble connectors")
+}
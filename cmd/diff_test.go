@@ -0,0 +1,43 @@
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/xoviat/jcad/lib"
+)
+
+func TestLoadGenerated(t *testing.T) {
+	dir := t.TempDir()
+	config := "output:\n  bom: \"{name}-jlc-bom.csv\"\n  cpl: \"{name}-jlc-cpl.csv\"\n"
+	if err := os.WriteFile(filepath.Join(dir, lib.CONFIG_FILE), []byte(config), 0666); err != nil {
+		t.Fatal(err)
+	}
+
+	for src, dst := range map[string]string{
+		"STM32F4_Breakout-BOM.csv":     "board-jlc-bom.csv",
+		"STM32F4_Breakout-all-pos.csv": "board-jlc-cpl.csv",
+	} {
+		data, err := os.ReadFile(filepath.Join("../test-data", src))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if err := os.WriteFile(filepath.Join(dir, dst), data, 0666); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	/* either file of the set finds the other by the configured names */
+	for _, name := range []string{"board-jlc-bom.csv", "board-jlc-cpl.csv"} {
+		assembly, err := loadGenerated(diffCmd, filepath.Join(dir, name))
+		if err != nil || len(assembly) == 0 || assembly["C1"] == nil || assembly["C1"].CID == "" {
+			t.Errorf("%s: unexpected assembly: %v", name, err)
+		}
+	}
+
+	if _, err := loadGenerated(diffCmd, filepath.Join(dir, "board-BOM.csv")); err == nil {
+		t.Errorf("expected a file that is not generated to be rejected")
+	}
+}
@@ -0,0 +1,120 @@
+/*
+Copyright © 2023 NAME HERE <EMAIL ADDRESS>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+	"github.com/xoviat/jcad/lib"
+)
+
+var dfix bool
+
+// doctorCmd represents the doctor command
+var doctorCmd = &cobra.Command{
+	Use:   "doctor",
+	Short: "Check the library for problems.",
+	Long: `Doctor scans the library and reports problems by category:
+
+	  missing       associations to parts without a component record
+	  incomplete    component records without a description
+	  stale-basic   basic or preferred parts that are no longer associated with their basic key
+	  invalid-key   association keys that do not follow the naming rules
+	  invalid-part  associations to something that is not a part
+	  orphan-index  search index entries for parts without a component record
+
+	With --fix, missing and incomplete parts are fetched from JLCPCB and
+	associations to parts that JLCPCB does not know are removed; those that
+	cannot be fetched for another reason are kept. Invalid
+	associations and orphaned index entries are removed. Stale basic and
+	preferred parts are fetched again: those that are now extended parts are
+	updated, and the others are associated with their basic key again unless
+	another basic or preferred part has it.
+
+	Example:
+		- jcad doctor
+		- jcad doctor --fix`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		config, err := loadConfig(cmd, "")
+		if err != nil {
+			fmt.Printf("failed to load configuration: %s\n", err)
+			return
+		}
+
+		library, err := lib.NewConfiguredLibrary(config, !dfix)
+		if err != nil {
+			fmt.Printf("failed to obtain default library: %s\n", err)
+			return
+		}
+		defer library.Close()
+
+		issues := library.Diagnose()
+		if len(issues) == 0 {
+			fmt.Println("no problems found")
+			return
+		}
+
+		counts := make(map[string]int)
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "PROBLEM\tKEY\tPART\tDETAIL\t")
+		for _, issue := range issues {
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t\n", issue.Kind, issue.Key, issue.CID, issue.Detail)
+			counts[issue.Kind]++
+		}
+		w.Flush()
+
+		for _, kind := range lib.ISSUE_KINDS {
+			if counts[kind] > 0 {
+				fmt.Printf("%s: %d\n", kind, counts[kind])
+			}
+		}
+
+		if !dfix {
+			fmt.Println("run jcad doctor --fix to fix these problems")
+			return
+		}
+
+		client := newComponentSource(config, library)
+		remaining, err := library.Repair(issues, func(cid string) (*lib.LibraryComponent, error) {
+			fmt.Printf("Loading data from JLCPCB for %s\n", cid)
+			lc, err := client.GetComponentDetail(cmd.Context(), cid)
+			if err != nil {
+				fmt.Printf("failed to load %s: %s\n", cid, err)
+			}
+
+			return lc, err
+		})
+		if err != nil {
+			fmt.Printf("failed to fix library: %s\n", err)
+			return
+		}
+
+		fmt.Printf("fixed %d problems\n", len(issues)-len(remaining))
+		for _, issue := range remaining {
+			fmt.Printf("could not fix %s %s %s\n", issue.Kind, issue.Key, issue.CID)
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(doctorCmd)
+
+	doctorCmd.Flags().BoolVarP(&dfix, "fix", "", false, "fetch missing data and remove invalid entries")
+}
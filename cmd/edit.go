@@ -29,27 +29,59 @@ import (
 )
 
 var (
-	ifile string
-	efile string
+	ifile      string
+	efile      string
+	emerge     bool
+	edryrun    bool
+	eoverwrite bool
 )
 
+/*
+either the library or the associations of a project
+*/
+type associationStore interface {
+	Records() []lib.AssociationRecord
+	ApplyAssociations(diff *lib.AssociationDiff, overwrite bool) error
+}
+
+func isTextAssociations(path string) bool {
+	return strings.HasSuffix(strings.ToLower(path), ".csv")
+}
+
 // editCmd represents the edit command
 var editCmd = &cobra.Command{
 	Use:   "edit",
 	Short: "Edit global or specific component associations.",
 	Long: `Edit allows modification, import, or export of existing component assocations.
 
+	Associations are exchanged either as an excel spreadsheet, which only
+	contains the component associations, or as a sorted CSV text file
+	(kind,key,value) that also contains the package associations and
+	can be reviewed and merged in version control.
+
 	Example:
-		- jcad edit                  : edit all component associations
-		- jcad edit <file.kicad_pcb> : edit component associations for a pcb
-		- jcad edit --export <file>   : export all component associations
-		- jcad edit --import <file>   : erase and import all component associations
+		- jcad edit                            : edit all component associations
+		- jcad edit <file.kicad_pcb>           : edit the project associations for a pcb
+		- jcad edit --export <file.xlsx|csv>   : export all component associations
+		- jcad edit --import <file.xlsx|csv>   : erase and import all component associations
+		- jcad edit --import <file> --merge    : add new associations and report conflicts
+		- jcad edit --import <file> --dry-run  : show the changes without importing
 	`,
 	Args: cobra.RangeArgs(0, 1),
 	Run: func(cmd *cobra.Command, args []string) {
-		export := func(library *lib.Library, path string) error {
+		export := func(store associationStore, path string) error {
 			fmt.Println("preparing to export component associations to file...")
 
+			if isTextAssociations(path) {
+				fp, err := os.Create(path)
+				if err != nil {
+					return fmt.Errorf("failed to create file: %s", err)
+				}
+				defer fp.Close()
+
+				return lib.WriteAssociations(fp, store.Records())
+			}
+
 			f := excelize.NewFile()
 			if _, err := f.NewSheet(string(lib.COMPONENTS_ASC_BKT)); err != nil {
 				return fmt.Errorf("failed to create new sheet: %s", err)
@@ -63,13 +95,15 @@ var editCmd = &cobra.Command{
 				return fmt.Errorf("failed to save as: %s", err)
 			}
 
-			assocations := library.ExportAssociations()
 			i := 1
-			for asc := range assocations {
-				// fmt.Printf("%s: %s\n", asc[0], asc[1])
+			for _, record := range store.Records() {
+				if record.Kind != lib.RECORD_COMPONENT {
+					continue
+				}
+
 				f.SetSheetRow(
 					string(lib.COMPONENTS_ASC_BKT),
-					"A"+strconv.Itoa(i), &[]interface{}{asc[0], asc[1]},
+					"A"+strconv.Itoa(i), &[]interface{}{record.Key, record.Value},
 				)
 
 				i++
@@ -78,60 +112,102 @@ var editCmd = &cobra.Command{
 			return f.Save()
 		}
 
-		fimport := func(library *lib.Library, path string) error {
-			fmt.Println("preparing to import component associations from file...")
+		/*
+			read the records in a file and the kinds of records that the file contains
+		*/
+		read := func(path string) ([]lib.AssociationRecord, []string, error) {
+			if isTextAssociations(path) {
+				fp, err := os.Open(path)
+				if err != nil {
+					return nil, nil, fmt.Errorf("failed to open file: %s", err)
+				}
+				defer fp.Close()
+
+				records, err := lib.ReadAssociations(fp)
+				return records, []string{lib.RECORD_COMPONENT, lib.RECORD_PACKAGE}, err
+			}
 
-			rows := make(chan []string, 100)
 			if !strings.HasSuffix(strings.ToLower(path), ".xls") &&
 				!strings.HasSuffix(strings.ToLower(path), ".xlsx") {
 
-				return fmt.Errorf("association file must be an excel spreadsheet")
+				return nil, nil, fmt.Errorf("association file must be an excel spreadsheet or csv file")
 			}
 
 			f, err := excelize.OpenFile(path)
 			if err != nil {
-				return fmt.Errorf("failed to open excel file: %s (%s)\n", path, err)
+				return nil, nil, fmt.Errorf("failed to open excel file: %s (%s)", path, err)
 			}
 
 			if f.GetSheetName(0) != string(lib.COMPONENTS_ASC_BKT) {
-				return fmt.Errorf("component-associations sheet must be present")
+				return nil, nil, fmt.Errorf("component-associations sheet must be present")
 			}
 
-			erows, err := f.Rows(f.GetSheetList()[0])
+			rows, err := f.GetRows(f.GetSheetList()[0])
 			if err != nil {
-				return fmt.Errorf("failed to get sheet list: %s (%s)\n", ifile, err)
+				return nil, nil, fmt.Errorf("failed to get rows: %s (%s)", path, err)
 			}
 
-			go func() {
-				for {
-					if end := !erows.Next(); end {
-						close(rows)
-						return
-					}
-
-					row, err := erows.Columns()
-					if err != nil || len(row) < 2 {
-						continue
-					}
+			records := []lib.AssociationRecord{}
+			for _, row := range rows {
+				if len(row) < 2 {
+					continue
+				}
 
-					rows <- row
+				value := strings.TrimSpace(row[1])
+				if value == "C0" {
+					value = lib.RECORD_SKIP
 				}
-			}()
 
-			err = library.ImportAssocations(rows)
-			if err != nil {
-				return fmt.Errorf("failed to import library: %s\n", err)
+				records = append(records, lib.AssociationRecord{
+					Kind: lib.RECORD_COMPONENT, Key: strings.TrimSpace(row[0]), Value: value,
+				})
 			}
 
-			return nil
+			return records, []string{lib.RECORD_COMPONENT}, nil
 		}
 
-		library, err := lib.NewDefaultLibrary(true)
-		if err != nil {
-			fmt.Printf("failed to obtain default library: %s\n", err)
-			return
+		fimport := func(store associationStore, path string) error {
+			fmt.Println("preparing to import component associations from file...")
+
+			records, kinds, err := read(path)
+			if err != nil {
+				return err
+			}
+
+			var diff *lib.AssociationDiff
+			if emerge {
+				diff = lib.DiffAssociations(store.Records(), records)
+			} else {
+				diff = lib.DiffAssociations(store.Records(), records, kinds...)
+			}
+
+			if edryrun {
+				diff.WriteText(os.Stdout)
+				return nil
+			}
+
+			/* when replacing, the file always takes precedence */
+			overwrite := eoverwrite || !emerge
+			if err := store.ApplyAssociations(diff, overwrite); err != nil {
+				return fmt.Errorf("failed to import library: %s", err)
+			}
+
+			if !overwrite {
+				for _, change := range diff.Changed {
+					fmt.Printf("conflict: %s %s is %s in the library and %s in the file; kept %s\n",
+						change.Kind, change.Key, change.Old, change.Value, change.Old,
+					)
+				}
+			}
+
+			fmt.Printf("imported %d new and %d changed associations, removed %d\n",
+				len(diff.Added), len(diff.Writes(overwrite))-len(diff.Added), len(diff.Removed),
+			)
+
+			return nil
 		}
 
+		var err error
 		pcb := ""
 		if len(args) > 0 && args[0] != "" {
 			pcb, err = lib.NormalizePCB(args[0])
@@ -141,18 +217,40 @@ var editCmd = &cobra.Command{
 			return
 		}
 
+		config, err := loadConfig(cmd, pcb)
+		if err != nil {
+			fmt.Printf("failed to load configuration: %s\n", err)
+			return
+		}
+
+		library, err := lib.NewConfiguredLibrary(config, efile != "" || edryrun)
+		if err != nil {
+			fmt.Printf("failed to obtain default library: %s\n", err)
+			return
+		}
+		defer library.Close()
+
 		lib.PrintHeader()
+
+		var store associationStore = library
 		if pcb != "" {
-			fmt.Println("editing components for pcb is not implemented")
+			project, err := lib.LoadProjectAssociations(lib.ProjectAssociationsPath(pcb))
+			if err != nil {
+				fmt.Printf("failed to load project associations: %s\n", err)
+				return
+			}
+
+			fmt.Printf("editing project associations in %s\n", project.Path())
+			store = project
 		}
 
 		if efile != "" {
-			if err := export(library, efile); err != nil {
+			if err := export(store, efile); err != nil {
 				fmt.Printf("failed to export lib: %s\n", err)
 				return
 			}
 		} else if ifile != "" {
-			if err := fimport(library, efile); err != nil {
+			if err := fimport(store, ifile); err != nil {
 				fmt.Printf("failed to import lib: %s\n", err)
 				return
 			}
@@ -170,7 +268,7 @@ var editCmd = &cobra.Command{
 				return
 			}
 
-			if err := export(library, tempf.Name()); err != nil {
+			if err := export(store, tempf.Name()); err != nil {
 				fmt.Printf("failed to export lib: %s\n", err)
 				return
 			}
@@ -195,7 +293,7 @@ var editCmd = &cobra.Command{
 				break
 			}
 
-			if err := fimport(library, tempf.Name()); err != nil {
+			if err := fimport(store, tempf.Name()); err != nil {
 				fmt.Printf("failed to import lib: %s\n", err)
 				return
 			}
@@ -208,6 +306,9 @@ func init() {
 
 	editCmd.Flags().StringVarP(&ifile, "import", "i", "", "file to import")
 	editCmd.Flags().StringVarP(&efile, "export", "e", "", "file to export")
+	editCmd.Flags().BoolVarP(&emerge, "merge", "m", false, "merge the imported associations instead of erasing")
+	editCmd.Flags().BoolVarP(&edryrun, "dry-run", "n", false, "show the changes that an import would make")
+	editCmd.Flags().BoolVarP(&eoverwrite, "overwrite", "", false, "when merging, replace conflicting associations")
 
 	// Here you will define your flags and configuration settings.
 
@@ -0,0 +1,126 @@
+/*
+Copyright © 2023 NAME HERE <EMAIL ADDRESS>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/spf13/cobra"
+	"github.com/xoviat/jcad/lib"
+)
+
+// explainCmd represents the explain command
+var explainCmd = &cobra.Command{
+	Use:   "explain <file.kicad_pcb> <designator>...",
+	Short: "Explain which association determines the part for a component.",
+	Long: `Explain shows the key of each designator and where its part comes from:
+	the project associations, an exact association in the library, an
+	association rule, or that it is not assembled or not yet associated.
+
+	Example:
+		- jcad explain <file.kicad_pcb> R1 U3`,
+	Args: cobra.MinimumNArgs(2),
+	Run: func(cmd *cobra.Command, args []string) {
+		pcb, err := lib.NormalizePCB(args[0])
+		if err != nil {
+			fmt.Println(err.Error())
+			return
+		}
+
+		config, err := loadConfig(cmd, pcb)
+		if err != nil {
+			fmt.Printf("failed to load configuration: %s\n", err)
+			return
+		}
+
+		library, err := lib.NewConfiguredLibrary(config, true)
+		if err != nil {
+			fmt.Printf("failed to obtain default library: %s\n", err)
+			return
+		}
+		defer library.Close()
+
+		kicad, err := lib.NewConfiguredKicadInterface(config)
+		if err != nil {
+			fmt.Printf("failed to obtain kicad instance: %s\n", err)
+			return
+		}
+
+		assocations, err := newAssociationMap(library, pcb)
+		if err != nil {
+			fmt.Println(err.Error())
+			return
+		}
+
+		filenames := newBoardFiles(pcb, config.Output)
+		exportPOS(kicad, pcb, filenames)
+
+		components := make(map[string]*lib.BoardComponent)
+		for _, component := range lib.ReadPOS(filenames.POS) {
+			components[component.Designator] = component
+		}
+
+		for _, designator := range args[1:] {
+			component, ok := components[designator]
+			if !ok {
+				fmt.Printf("%s: not found on the board\n", designator)
+				continue
+			}
+
+			explanation := assocations.Explain(component)
+			fmt.Printf("%s: key %s\n", designator, explanation.Key)
+
+			switch explanation.Source {
+			case lib.SOURCE_EXCLUDED:
+				fmt.Println("  not assembled: the designator prefix is excluded")
+				continue
+			case lib.SOURCE_PROJECT:
+				fmt.Printf("  project association in %s\n", lib.ProjectAssociationsPath(pcb))
+			case lib.SOURCE_LIBRARY:
+				fmt.Println("  exact association in the library")
+			case lib.SOURCE_RULE:
+				fmt.Printf("  rule %s\n", explanation.Rule)
+			default:
+				fmt.Println("  not associated; run jcad generate to associate it")
+				continue
+			}
+
+			lc := explanation.Component
+			switch {
+			case lc.IsSkipped():
+				fmt.Println("  skipped: hand soldered")
+			case lc.IsSourced():
+				fmt.Printf("  %s\n", lc.Reference())
+			default:
+				fmt.Printf("  %s %s %s %s\n", lc.CID(), lc.Part, lc.Package, lc.Description)
+				fmt.Printf("    library type: %s\n", lc.TypeName())
+				for _, attribute := range lc.Attributes {
+					fmt.Printf("    %s: %s\n", attribute.Name, attribute.Value)
+				}
+
+				if lc.Datasheet != "" {
+					fmt.Printf("    datasheet: %s\n", lc.Datasheet)
+				}
+			}
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(explainCmd)
+
+	explainCmd.Flags().BoolVarP(&connectors, "connectors", "", false, "whether to assemble connectors")
+}
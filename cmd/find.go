@@ -0,0 +1,141 @@
+/*
+Copyright © 2020 Mars Galactic <EMAIL ADDRESS>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+	"github.com/xoviat/jcad/lib"
+)
+
+var (
+	fquery lib.ComponentQuery
+	fall   bool
+	flimit int
+	fjson  bool
+)
+
+// findCmd represents the find command
+var findCmd = &cobra.Command{
+	Use:   "find [keyword]...",
+	Short: "Search the JLCPCB parts.",
+	Long: `Find searches all of the JLCPCB parts, unlike search, which only
+	searches the parts in the local library.
+
+	The filters are applied by JLCPCB. One page of results is shown unless
+	--all is given, in which case every page is fetched up to --limit parts.
+
+	Example:
+		- jcad find --package 0603 --type base 10k
+		- jcad find --type preferred --in-stock USB-C
+		- jcad find --category Resistors --attribute 10kΩ --in-stock
+		- jcad find --brand "Texas Instruments" --all --limit 200 LDO`,
+	Run: func(cmd *cobra.Command, args []string) {
+		config, err := loadConfig(cmd, "")
+		if err != nil {
+			fmt.Printf("failed to load configuration: %s\n", err)
+			return
+		}
+
+		switch fquery.LibraryType {
+		case "", lib.LIBRARY_BASIC, lib.LIBRARY_PREFERRED, lib.LIBRARY_EXTENDED:
+		default:
+			fmt.Printf("invalid library type %s: expected base, preferred or expand\n", fquery.LibraryType)
+			return
+		}
+
+		var library *lib.Library
+		if config.Offline {
+			library, err = lib.NewConfiguredLibrary(config, true)
+			if err != nil {
+				fmt.Printf("failed to obtain default library: %s\n", err)
+				return
+			}
+			defer library.Close()
+		}
+
+		client := newComponentSource(config, library)
+		fquery.Keyword = strings.Join(args, " ")
+
+		var components []*lib.LibraryComponent
+		hasNext := false
+		if fall {
+			components, err = lib.FindAll(cmd.Context(), client, fquery, flimit)
+		} else {
+			var page *lib.ComponentPage
+			if page, err = client.FindComponents(cmd.Context(), fquery); err == nil {
+				components, hasNext = page.Components, page.HasNext
+			}
+		}
+		if err != nil {
+			fmt.Printf("failed to search JLCPCB: %s\n", err)
+			if len(components) == 0 {
+				return
+			}
+		}
+
+		if fjson {
+			enc := json.NewEncoder(os.Stdout)
+			enc.SetIndent("", "  ")
+			if err := enc.Encode(components); err != nil {
+				fmt.Printf("failed to encode results: %s\n", err)
+			}
+
+			return
+		}
+
+		if len(components) == 0 {
+			fmt.Println("no parts found")
+			return
+		}
+
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "PART\tTYPE\tPACKAGE\tMPN\tSTOCK\tDESCRIPTION\t")
+		for _, component := range components {
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%d\t%s\t\n",
+				component.CID(), component.TypeName(), component.Package, component.Part,
+				component.Stock, component.Description,
+			)
+		}
+		w.Flush()
+
+		if hasNext {
+			fmt.Printf("more parts are available; run again with --page %d or --all\n", max(fquery.Page, 1)+1)
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(findCmd)
+
+	findCmd.Flags().StringVarP(&fquery.Category, "category", "", "", "only find parts in this category, e.g. Resistors")
+	findCmd.Flags().StringVarP(&fquery.Subcategory, "subcategory", "", "", "only find parts in this subcategory")
+	findCmd.Flags().StringVarP(&fquery.Package, "package", "", "", "only find parts with this package")
+	findCmd.Flags().StringVarP(&fquery.LibraryType, "type", "", "", "only find base, preferred or expand parts")
+	findCmd.Flags().BoolVarP(&fquery.InStock, "in-stock", "", false, "only find parts that are in stock")
+	findCmd.Flags().StringVarP(&fquery.Brand, "brand", "", "", "only find parts from this manufacturer")
+	findCmd.Flags().StringSliceVarP(&fquery.Attributes, "attribute", "", []string{}, "only find parts with this attribute value")
+	findCmd.Flags().IntVarP(&fquery.Page, "page", "", 1, "the page of results to show")
+	findCmd.Flags().IntVarP(&fquery.PageSize, "page-size", "", 0, "the number of parts on each page")
+	findCmd.Flags().BoolVarP(&fall, "all", "", false, "fetch every page of results")
+	findCmd.Flags().IntVarP(&flimit, "limit", "", 500, "the maximum number of parts to fetch with --all")
+	findCmd.Flags().BoolVarP(&fjson, "json", "", false, "write the results as JSON")
+}
@@ -16,14 +16,11 @@ limitations under the License.
 package cmd
 
 import (
+	"context"
 	"fmt"
-	"os"
-	"path"
-	"path/filepath"
 	"strings"
 
 	"github.com/c-bata/go-prompt"
-	"github.com/mholt/archiver"
 	"github.com/spf13/cobra"
 	"github.com/xoviat/jcad/lib"
 )
@@ -40,71 +37,52 @@ var generateCmd = &cobra.Command{
 	Long: `Generate manufacturing outputs for JLCPCB from a KiCAD board file:
 		- A ZIP file containing the gerber files used to create the PCB.
 		- CPL and BOM files used to place the SMT components.
+		- A BOM of consigned and globally sourced components.
+		- A hand-solder BOM and LCSC cart file for components that
+		  will not be placed by JLCPCB.
+
+	At the prompt, enter an LCSC part number, consigned:<MPN> or
+	global:<MPN> for a consigned or globally sourced part, or
+	nothing to skip the component.
 		
 	Example:
 		- jcad generate <file.kicad_pcb>`,
 	Args: cobra.ExactArgs(1),
 	Run: func(cmd *cobra.Command, args []string) {
-		library, err := lib.NewDefaultLibrary(connectors)
+		pcb, err := lib.NormalizePCB(args[0])
 		if err != nil {
-			fmt.Printf("failed to obtain default library: %s\n", err)
+			fmt.Println(err.Error())
 			return
 		}
 
-		kicad, err := lib.NewKicadInterface()
+		config, err := loadConfig(cmd, pcb)
 		if err != nil {
-			fmt.Printf("failed to obtain kicad instance: %s\n", err)
+			fmt.Printf("failed to load configuration: %s\n", err)
 			return
 		}
 
-		pcb, err := lib.NormalizePCB(args[0])
+		library, err := lib.NewConfiguredLibrary(config, false)
 		if err != nil {
-			fmt.Println(err.Error())
+			fmt.Printf("failed to obtain default library: %s\n", err)
 			return
 		}
+		defer library.Close()
+
+		run := library.BeginRun(pcb)
 
-		rname := strings.TrimSuffix(filepath.Base(pcb), path.Ext(pcb))
-		filenames := struct {
-			Name    string
-			POS     string
-			BOM     string
-			CPL     string
-			Gerbers string
-			ZIP     string
-		}{
-			Name:    rname,
-			POS:     filepath.Join(filepath.Dir(pcb), rname+"-data.pos"),
-			BOM:     filepath.Join(filepath.Dir(pcb), rname+"-BOM.csv"),
-			CPL:     filepath.Join(filepath.Dir(pcb), rname+"-all-pos.csv"),
-			Gerbers: filepath.Join(filepath.Dir(pcb), rname+"-gerber"),
-			ZIP:     filepath.Join(filepath.Dir(pcb), rname+"-gerber.zip"),
+		kicad, err := lib.NewConfiguredKicadInterface(config)
+		if err != nil {
+			fmt.Printf("failed to obtain kicad instance: %s\n", err)
+			return
 		}
 
+		filenames := newBoardFiles(pcb, config.Output)
+
 		lib.PrintHeader()
 		fmt.Printf("Using KiCad bin path: %s\n", kicad.GetBinPath())
 		fmt.Printf("Processing %s\n", pcb)
 
-		os.RemoveAll(filenames.Gerbers)
-		os.MkdirAll(filenames.Gerbers, 0777)
-
-		kicad.ExecuteCommand(
-			[]string{
-				"pcb", "export", "gerbers", filepath.Join("..", filepath.Base(pcb)),
-			}, filenames.Gerbers,
-		)
-		kicad.ExecuteCommand(
-			[]string{
-				"pcb", "export", "drill", filepath.Join("..", filepath.Base(pcb)),
-			}, filenames.Gerbers,
-		)
-		kicad.ExecuteCommand(
-			[]string{
-				"pcb", "export", "pos", filepath.Base(pcb),
-				"--output", filenames.POS,
-				"--units", "mm",
-				"--format", "csv",
-			}, filepath.Dir(pcb),
-		)
+		exportBoard(kicad, pcb, filenames)
 
 		/* map of components to clear */
 		mclear := make(map[string]struct{})
@@ -112,10 +90,16 @@ var generateCmd = &cobra.Command{
 			mclear[designator] = struct{}{}
 		}
 
-		client := lib.NewJLC()
+		client := newComponentSource(config, library)
 		bom := make(lib.BOM)
+		consigned := make(lib.ConsignedBOM)
+		hand := make(lib.HandBOM)
 		components := lib.ReadPOS(filenames.POS)
-		assocations := lib.NewAssociationMap(library)
+		assocations, err := newAssociationMap(library, pcb)
+		if err != nil {
+			fmt.Println(err.Error())
+			return
+		}
 
 		/*
 			filter components that we may possibly assemble
@@ -123,7 +107,10 @@ var generateCmd = &cobra.Command{
 		*/
 		for _, component := range components {
 			if _, ok := mclear[component.Designator]; ok {
-				assocations.Associate(component, nil)
+				if err := assocations.Associate(component, nil); err != nil {
+					fmt.Printf("failed to clear the association of %s: %s\n", component.Designator, err)
+					return
+				}
 			}
 		}
 
@@ -131,6 +118,7 @@ var generateCmd = &cobra.Command{
 			retreive associations that we haven't from the user
 		*/
 		i := 0
+		unresolved := []*lib.BoardComponent{}
 		for _, component := range components {
 			if component.IsAbnormal() {
 				fmt.Printf("Component %s has abnormal comment, aborting...\n", component.Designator)
@@ -140,34 +128,23 @@ var generateCmd = &cobra.Command{
 			/*
 				if we've marked this as a component to skip
 			*/
-			if lc := assocations.FindAssociated(component); lc != nil && lc.ID == 0 {
+			if lc := assocations.FindAssociated(component); lc != nil && lc.IsSkipped() {
+				hand.AddComponent(component, assocations.FindKnown(component))
+				continue
+			}
+
+			/*
+				offline, there is nothing to prompt against, so leave the component for later
+			*/
+			if lc := assocations.FindAssociated(component); lc == nil && config.Offline {
+				unresolved = append(unresolved, component)
 				continue
 			}
 
 			if lc := assocations.FindAssociated(component); lc == nil {
-				fmt.Printf("Enter component ID for %s, %s, %s\n:", component.Designator, component.Comment, component.Package)
-				results, _ := client.SelectComponentList(component.Comment)
-
-				cid := prompt.Input("> ", func(d prompt.Document) []prompt.Suggest {
-					suggestions := make([]prompt.Suggest, len(results))
-
-					i := 0
-					for _, result := range results {
-						suggestions[i] = prompt.Suggest{
-							Text: result.CID(), Description: result.Part + " : " + result.Description,
-						}
-						i++
-					}
-
-					return prompt.FilterHasPrefix(suggestions, d.GetWordBeforeCursor(), true)
-				})
-
-				if cid == "" {
-					assocations.Associate(component, &lib.LibraryComponent{})
-				} else if result, ok := results[lib.FromCID(cid)]; ok {
-					assocations.Associate(component, result)
-				} else {
-					assocations.Associate(component, client.Exact(cid))
+				if err := promptComponent(cmd.Context(), client, library, assocations, component, inputPrompt); err != nil {
+					fmt.Printf("failed to associate %s: %s\n", component.Designator, err)
+					return
 				}
 			}
 
@@ -176,35 +153,119 @@ var generateCmd = &cobra.Command{
 			*/
 			if lc := assocations.FindAssociated(component); lc != nil && lc.ID != 0 && lc.Description == "" {
 				fmt.Printf("Loading data from JLCPCB for %s\n", component.Designator)
-				assocations.Associate(component, client.Exact(lc.CID()))
+				if detail, err := client.GetComponentDetail(cmd.Context(), lc.CID()); err != nil {
+					fmt.Printf("failed to load %s: %s\n", lc.CID(), err)
+				} else {
+					assocations.Load(component, detail)
+				}
 			}
 
 			/*
 				if we've marked this as a component to skip
 			*/
-			if lc := assocations.FindAssociated(component); lc != nil && lc.ID == 0 {
+			if lc := assocations.FindAssociated(component); lc != nil && lc.IsSkipped() {
+				hand.AddComponent(component, assocations.FindKnown(component))
 				continue
 			}
 
 			components[i] = component
 			i++
 
-			lc := assocations.FindAssociated(component)
 			/*
 				add the component to the BOM
 			*/
-			bom.AddComponent(component, lc)
+			lib.AddToBOM(bom, consigned, component, assocations.FindAssociated(component))
 		}
 		components = components[:i]
 
-		lib.WriteBOM(filenames.BOM, bom)
-		lib.WriteCPL(filenames.CPL, components)
+		cids := []string{}
+		for _, entry := range bom {
+			cids = append(cids, entry.Component.CID())
+		}
+		if err := library.RecordBoard(pcb, cids); err != nil {
+			fmt.Printf("failed to record board parts: %s\n", err)
+		}
 
-		os.Remove(filenames.ZIP)
-		archiver.Archive([]string{filenames.Gerbers}, filenames.ZIP)
+		writeBoardFiles(filenames, bom, consigned, hand, components)
+
+		if n := bom.ExtendedParts(); n > 0 {
+			fmt.Printf("%d extended parts with a loading fee of %1.2f each\n", n, lib.LOADING_FEE)
+		}
+
+		if len(unresolved) > 0 {
+			fmt.Printf("%d components are not associated and were left out of the generated files:\n", len(unresolved))
+			for _, component := range unresolved {
+				fmt.Printf("  %s %s %s\n", component.Designator, component.Comment, component.Package)
+			}
+			fmt.Println("run jcad generate again without --offline to associate them")
+		}
+
+		if changes := library.History(func(entry *lib.HistoryEntry) bool { return entry.Run == run }); len(changes) > 0 {
+			fmt.Printf("%d associations changed; undo them with jcad undo --run %s\n", len(changes), run)
+		}
 	},
 }
 
+/*
+read a line at the prompt, completing from the suggestions
+*/
+type promptInput func(prefix string, suggestions []prompt.Suggest) string
+
+func inputPrompt(prefix string, suggestions []prompt.Suggest) string {
+	return prompt.Input(prefix, func(d prompt.Document) []prompt.Suggest {
+		return prompt.FilterHasPrefix(suggestions, d.GetWordBeforeCursor(), true)
+	})
+}
+
+/*
+prompt for the part of a component until it is associated or skipped
+
+A part that cannot be looked up, or that does not fit the footprint and is
+not confirmed, is asked for again
+*/
+func promptComponent(
+	ctx context.Context, client lib.ComponentSource, library *lib.Library,
+	assocations *lib.AssocationMap, component *lib.BoardComponent, input promptInput,
+) error {
+	fmt.Printf("Enter component ID for %s, %s, %s\n:", component.Designator, component.Comment, component.Package)
+	suggested, err := lib.SuggestComponents(ctx, client, library, component)
+	if err != nil {
+		fmt.Printf("failed to search JLCPCB for %s: %s\n", component.Comment, err)
+		fmt.Println("enter a part number, or leave empty to skip")
+	}
+
+	suggestions := make([]prompt.Suggest, 0, len(suggested))
+	for _, result := range suggested {
+		suggestions = append(suggestions, prompt.Suggest{
+			Text: result.CID(), Description: result.Package + " : " + result.TypeName() + " : " + result.Part + " : " + result.Description,
+		})
+	}
+
+	for {
+		cid := input("> ", suggestions)
+		selected, err := lib.SelectComponent(ctx, client, suggested, cid)
+		if err != nil {
+			fmt.Printf("failed to look up %s: %s\n", strings.TrimSpace(cid), err)
+			fmt.Println("enter another part number, or leave empty to skip")
+			continue
+		}
+
+		/*
+			catch obvious mistakes such as a 0402 part on a 0603 footprint
+		*/
+		if err := library.CheckPackage(component, selected); err != nil {
+			fmt.Printf("Package mismatch: %s\n", err)
+			confirm := input("associate anyway? [y/N] ", []prompt.Suggest{})
+
+			if !strings.EqualFold(strings.TrimSpace(confirm), "y") {
+				continue
+			}
+		}
+
+		return assocations.Associate(component, selected)
+	}
+}
+
 func init() {
 	rootCmd.AddCommand(generateCmd)
 
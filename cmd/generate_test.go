@@ -0,0 +1,72 @@
+package cmd
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/c-bata/go-prompt"
+	"github.com/xoviat/jcad/lib"
+	"github.com/xoviat/jcad/lib/jlctest"
+)
+
+func TestPromptComponent(t *testing.T) {
+	s, err := jlctest.NewServer("../test-data")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	delay := time.Duration(0)
+	client := lib.NewConfiguredJLC(lib.JLCConfig{URL: s.BaseURL(), HTTPClient: s.Client(), Delay: &delay})
+
+	root := t.TempDir()
+	library, err := lib.NewLibrary(root, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer library.Close()
+
+	project, err := lib.LoadProjectAssociations(filepath.Join(root, lib.PROJECT_ASSOCIATIONS))
+	if err != nil {
+		t.Fatal(err)
+	}
+	assocations := lib.NewProjectAssociationMap(library, project)
+
+	/*
+		a part that cannot be looked up, then a part with the wrong package
+		that is not confirmed, and then the right part
+	*/
+	inputs := []string{"C99999999", "C8056", "n", "C1547"}
+	prompts := []string{}
+	input := func(prefix string, suggestions []prompt.Suggest) string {
+		prompts = append(prompts, prefix)
+		if len(prompts) > len(inputs) {
+			t.Fatalf("unexpected prompt %q", prefix)
+		}
+
+		return inputs[len(prompts)-1]
+	}
+
+	component := &lib.BoardComponent{Designator: "C1", Comment: "12p", Package: "C_0402_1005Metric"}
+	if err := promptComponent(context.Background(), client, library, assocations, component, input); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(prompts) != 4 || prompts[0] != "> " || prompts[1] != "> " || prompts[2] != "associate anyway? [y/N] " || prompts[3] != "> " {
+		t.Errorf("unexpected prompts: %q", prompts)
+	}
+
+	if lc := library.FindAssociated(component); lc == nil || lc.CID() != "C1547" {
+		t.Errorf("expected the part to be associated, got %+v", lc)
+	}
+
+	if lc := library.Exact("C99999999"); lc.Part != "" {
+		t.Errorf("expected the missing part not to be stored, got %+v", lc)
+	}
+
+	if n := s.Requests("getComponentDetail"); n < 2 {
+		t.Errorf("expected the details to be requested, got %d requests", n)
+	}
+}
@@ -0,0 +1,83 @@
+/*
+Copyright © 2023 NAME HERE <EMAIL ADDRESS>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/spf13/cobra"
+	"github.com/xoviat/jcad/lib"
+)
+
+var (
+	hrun   string
+	hlimit int
+)
+
+// historyCmd represents the history command
+var historyCmd = &cobra.Command{
+	Use:   "history [key]",
+	Short: "Show the changes to component associations.",
+	Long: `History shows when, by whom and for which board each component
+	association was changed, newest last. Without a key, the latest changes
+	to all associations are shown.
+
+	Example:
+		- jcad history R:10k:R_0603_1608Metric
+		- jcad history --run 20240101-120000.000
+		- jcad history --limit 100`,
+	Args: cobra.MaximumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		config, err := loadConfig(cmd, "")
+		if err != nil {
+			fmt.Printf("failed to load configuration: %s\n", err)
+			return
+		}
+
+		library, err := lib.NewConfiguredLibrary(config, true)
+		if err != nil {
+			fmt.Printf("failed to obtain default library: %s\n", err)
+			return
+		}
+		defer library.Close()
+
+		entries := library.History(func(entry *lib.HistoryEntry) bool {
+			return (len(args) == 0 || entry.Key == args[0]) && (hrun == "" || entry.Run == hrun)
+		})
+		if len(entries) == 0 {
+			fmt.Println("no changes found")
+			return
+		}
+
+		if hlimit > 0 && len(entries) > hlimit {
+			entries = entries[len(entries)-hlimit:]
+		}
+
+		for _, entry := range entries {
+			fmt.Println(entry)
+			if entry.Run != "" {
+				fmt.Printf("    run %s\n", entry.Run)
+			}
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(historyCmd)
+
+	historyCmd.Flags().StringVarP(&hrun, "run", "", "", "only show the changes made during this run")
+	historyCmd.Flags().IntVarP(&hlimit, "limit", "", 20, "the maximum number of changes to show")
+}
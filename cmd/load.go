@@ -16,41 +16,196 @@ limitations under the License.
 package cmd
 
 import (
+	"context"
 	"fmt"
 
 	"github.com/spf13/cobra"
 	"github.com/xoviat/jcad/lib"
 )
 
+var (
+	lrestart bool
+	lfrom    string
+)
+
 // loadCmd represents the load command
 var loadCmd = &cobra.Command{
 	Use:   "load",
-	Short: "Load the basic parts list",
-	Long:  `Load the basic parts list from the JLCBPCB website.`,
+	Short: "Load the basic and preferred parts lists",
+	Long: `Load the basic and preferred parts lists from the JLCBPCB website.
+
+	With --from, basic, preferred and extended parts are imported from the
+	JLCPCB parts catalogue instead, which can be downloaded as a spreadsheet
+	or saved as a CSV file. This does not need a connection.
+
+	The parts are staged page by page and replace the basic and preferred
+	parts of the library only once every page has been loaded. Extended
+	parts are kept, and parts that are no longer basic or preferred are kept
+	as extended parts. If the load is interrupted, running it again resumes
+	after the last page that was loaded.
+
+	Example:
+		- jcad load
+		- jcad load --restart
+		- jcad load --from JLCPCB_SMT_Parts_Library.xlsx`,
 	Run: func(cmd *cobra.Command, args []string) {
-		library, err := lib.NewDefaultLibrary(false)
+		config, err := loadConfig(cmd, "")
 		if err != nil {
-			fmt.Printf("failed to open or create default library: %s\n", err)
+			fmt.Printf("failed to load configuration: %s\n", err)
 			return
 		}
 
-		fmt.Println("loading basic components from JLCPCB")
-		client := lib.NewJLC()
-
-		components, errs := client.SelectBaseComponentList()
+		if lfrom != "" {
+			loadCatalogue(config, lfrom)
+			return
+		}
 
-		err = library.ImportBasic(components, errs)
-		if err != nil {
-			fmt.Println("failed to load basic compnent list")
+		if config.Offline {
+			fmt.Println("the basic and preferred parts lists cannot be loaded offline")
 			return
 		}
 
+		if lrestart {
+			if err := updateLibrary(config, (*lib.Library).DiscardStaged); err != nil {
+				fmt.Printf("failed to open or create default library: %s\n", err)
+				return
+			}
+		}
+
+		client := newComponentSource(config, nil)
+		for _, list := range []string{lib.LIBRARY_BASIC, lib.LIBRARY_PREFERRED} {
+			if !loadList(cmd.Context(), config, client, list) {
+				fmt.Println("run jcad load again to resume")
+				return
+			}
+		}
+
+		if err := commitLoad(config, (*lib.Library).CommitStaged); err != nil {
+			fmt.Printf("failed to load basic component list: %s\n", err)
+		}
 	},
 }
 
+/*
+stage every page of the basic or preferred parts, resuming after the last
+page that was staged, and return whether the whole list was staged
+
+the library is only opened to stage each page so that other commands can
+use the library while the parts are downloaded
+*/
+func loadList(ctx context.Context, config *lib.Config, client lib.ComponentSource, list string) bool {
+	page := 1
+	err := updateLibrary(config, func(library *lib.Library) error {
+		page = library.StagedPage(list) + 1
+		return nil
+	})
+	if err != nil {
+		fmt.Printf("failed to open or create default library: %s\n", err)
+		return false
+	}
+
+	name := lib.LibraryTypeName(list)
+	fmt.Printf("loading %s components from JLCPCB\n", name)
+	if page > 1 {
+		fmt.Printf("resuming after page %d\n", page-1)
+	}
+
+	loaded := (page - 1) * lib.BASIC_PAGE_SIZE
+	for {
+		result, err := client.SelectLibraryPage(ctx, list, page)
+		if err != nil {
+			fmt.Printf("failed to load %s component list: %s\n", name, err)
+			return false
+		}
+
+		if len(result.Components) > 0 {
+			err = updateLibrary(config, func(library *lib.Library) error {
+				return library.StageParts(list, page, result.Components)
+			})
+			if err != nil {
+				fmt.Printf("failed to stage page %d: %s\n", page, err)
+				return false
+			}
+		}
+
+		loaded += len(result.Components)
+		if result.Total > 0 {
+			fmt.Printf("loaded %d of %d %s parts\n", loaded, result.Total, name)
+		} else {
+			fmt.Printf("loaded %d %s parts\n", loaded, name)
+		}
+
+		if !result.HasNext {
+			return true
+		}
+		page++
+	}
+}
+
+/*
+import the parts of a catalogue file into the library
+*/
+func loadCatalogue(config *lib.Config, path string) {
+	/* the catalogue is read before the library is opened because it can be large */
+	components, err := lib.ReadCatalogue(path)
+	if err != nil {
+		fmt.Printf("failed to read parts catalogue: %s\n", err)
+		return
+	}
+
+	fmt.Printf("importing %d parts from %s\n", len(components), path)
+
+	err = commitLoad(config, func(library *lib.Library) (lib.LoadSummary, error) {
+		return library.ImportParts(components)
+	})
+	if err != nil {
+		fmt.Printf("failed to import parts catalogue: %s\n", err)
+	}
+}
+
+/*
+commit the loaded parts as one run so that the changes to the basic keys
+can be undone, and print what changed
+*/
+func commitLoad(config *lib.Config, commit func(library *lib.Library) (lib.LoadSummary, error)) error {
+	return updateLibrary(config, func(library *lib.Library) error {
+		run := library.BeginRun("")
+		summary, err := commit(library)
+		if err != nil {
+			return err
+		}
+
+		fmt.Printf("%d added, %d updated, %d unchanged, %d no longer basic or preferred\n",
+			summary.Added, summary.Updated, summary.Unchanged, summary.Demoted,
+		)
+
+		if changes := library.History(func(entry *lib.HistoryEntry) bool { return entry.Run == run }); len(changes) > 0 {
+			fmt.Printf("%d associations changed; undo them with jcad undo --run %s\n", len(changes), run)
+		}
+
+		return nil
+	})
+}
+
+/*
+open the library for writing, update it, and close it again
+*/
+func updateLibrary(config *lib.Config, update func(library *lib.Library) error) error {
+	library, err := lib.NewConfiguredLibrary(config, false)
+	if err != nil {
+		return err
+	}
+	defer library.Close()
+
+	return update(library)
+}
+
 func init() {
 	rootCmd.AddCommand(loadCmd)
 
+	loadCmd.Flags().BoolVarP(&lrestart, "restart", "", false, "discard the parts of an interrupted load and start again")
+	loadCmd.Flags().StringVarP(&lfrom, "from", "", "", "import the parts from a JLCPCB parts catalogue (.xlsx or .csv)")
+
 	// Here you will define your flags and configuration settings.
 
 	// Cobra supports Persistent Flags which will work for this command
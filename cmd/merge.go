@@ -0,0 +1,193 @@
+/*
+Copyright © 2023 NAME HERE <EMAIL ADDRESS>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+	"github.com/xoviat/jcad/lib"
+)
+
+var (
+	mqty    []int
+	moutput string
+)
+
+// mergeCmd represents the bom merge command
+var mergeCmd = &cobra.Command{
+	Use:   "merge",
+	Short: "Combine the BOMs of several boards into one order.",
+	Long: `Merge resolves each board through the library and sums the quantity of
+	each part over all of the boards. The upload files for each board are
+	generated as usual, and a combined report with stock and cost is written.
+
+	Components that have not been associated are listed and must be
+	associated with jcad generate before they are included. The upload
+	files of a board with such components are not written, so that files
+	generated earlier are not replaced with incomplete ones.
+
+	Example:
+		- jcad bom merge <a.kicad_pcb> <b.kicad_pcb> --qty 10,5`,
+	Args: cobra.MinimumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		if len(mqty) == 0 {
+			for range args {
+				mqty = append(mqty, 1)
+			}
+		}
+
+		if len(mqty) != len(args) {
+			fmt.Printf("expected %d quantities but got %d\n", len(args), len(mqty))
+			return
+		}
+
+		config, err := loadConfig(cmd, args[0])
+		if err != nil {
+			fmt.Printf("failed to load configuration: %s\n", err)
+			return
+		}
+
+		library, err := lib.NewConfiguredLibrary(config, true)
+		if err != nil {
+			fmt.Printf("failed to obtain default library: %s\n", err)
+			return
+		}
+		defer library.Close()
+
+		kicad, err := lib.NewConfiguredKicadInterface(config)
+		if err != nil {
+			fmt.Printf("failed to obtain kicad instance: %s\n", err)
+			return
+		}
+
+		lib.PrintHeader()
+		fmt.Printf("Using KiCad bin path: %s\n", kicad.GetBinPath())
+
+		boards := []*lib.Board{}
+		merged := make(lib.MergedBOM)
+		incomplete := false
+		for i, arg := range args {
+			pcb, err := lib.NormalizePCB(arg)
+			if err != nil {
+				fmt.Println(err.Error())
+				return
+			}
+
+			for _, board := range boards {
+				if board.PCB == pcb {
+					fmt.Printf("%s is given more than once\n", arg)
+					return
+				}
+			}
+
+			fmt.Printf("Processing %s\n", pcb)
+
+			assocations, err := newAssociationMap(library, pcb)
+			if err != nil {
+				fmt.Println(err.Error())
+				return
+			}
+
+			bconfig, err := loadConfig(cmd, pcb)
+			if err != nil {
+				fmt.Printf("failed to load configuration: %s\n", err)
+				return
+			}
+
+			filenames := newBoardFiles(pcb, bconfig.Output)
+			exportBoard(kicad, pcb, filenames)
+
+			board := lib.ResolveBoard(
+				pcb, filenames.Name, mqty[i], lib.ReadPOS(filenames.POS), assocations,
+			)
+			for _, component := range board.Unresolved {
+				fmt.Printf(
+					"%s: %s is not associated (%s, %s); run jcad generate to associate it\n",
+					board.Name, component.Designator, component.Comment, component.Package,
+				)
+			}
+
+			/* upload files without the unresolved components would be incomplete */
+			if len(board.Unresolved) > 0 {
+				fmt.Printf("%s: the upload files were not written because components are not associated\n", board.Name)
+				incomplete = true
+			} else {
+				writeBoardFiles(filenames, board.BOM, board.Consigned, board.Hand, board.Placed)
+			}
+
+			boards = append(boards, board)
+			merged.AddBoard(board)
+		}
+
+		/*
+			fetch stock and prices for components that were cached without them
+		*/
+		client := newComponentSource(config, library)
+		for _, entry := range merged {
+			if len(entry.Component.Prices) == 0 {
+				fmt.Printf("Loading data from JLCPCB for %s\n", entry.Component.CID())
+				lc, err := client.GetComponentDetail(cmd.Context(), entry.Component.CID())
+				if err != nil {
+					fmt.Printf("failed to load %s: %s\n", entry.Component.CID(), err)
+					continue
+				}
+
+				entry.Component = lc
+			}
+		}
+
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "PART\tTYPE\tCOMMENT\tFOOTPRINT\tQTY\tSTOCK\tUNIT\tCOST\t")
+		for _, id := range merged.IDs() {
+			entry := merged[id]
+
+			stock := fmt.Sprintf("%d", entry.Component.Stock)
+			if !entry.InStock() {
+				stock += " (short)"
+			}
+
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%d\t%s\t%1.4f\t%1.2f\t\n",
+				entry.Component.CID(), entry.Component.TypeName(), entry.Comment, entry.Package, entry.Quantity,
+				stock, entry.Component.UnitPrice(entry.Quantity), entry.Cost(),
+			)
+		}
+		w.Flush()
+
+		fmt.Printf("Total parts cost: %1.2f\n", merged.Cost())
+		fmt.Printf("Extended part loading fees: %1.2f\n", merged.LoadingFees())
+
+		if err := lib.WriteMergedBOM(moutput, merged, boards); err != nil {
+			fmt.Printf("failed to write combined report: %s\n", err)
+			return
+		}
+
+		fmt.Printf("Combined report written to %s\n", moutput)
+		if incomplete {
+			fmt.Println("the report does not include the components that are not associated")
+		}
+	},
+}
+
+func init() {
+	bomCmd.AddCommand(mergeCmd)
+
+	mergeCmd.Flags().IntSliceVarP(&mqty, "qty", "q", []int{}, "number of each board to order")
+	mergeCmd.Flags().StringVarP(&moutput, "output", "o", "merged-BOM.csv", "combined report file")
+	mergeCmd.Flags().BoolVarP(&connectors, "connectors", "", false, "whether to assemble connectors")
+}
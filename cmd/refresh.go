@@ -0,0 +1,165 @@
+/*
+Copyright © 2020 Mars Galactic <EMAIL ADDRESS>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/signal"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+	"github.com/xoviat/jcad/lib"
+)
+
+var (
+	rminStock int64
+)
+
+// refreshCmd represents the refresh command
+var refreshCmd = &cobra.Command{
+	Use:   "refresh [file.kicad_pcb]",
+	Short: "Refresh the stock and prices of the associated parts.",
+	Long: `Refresh fetches the current stock, prices and library type of every
+	part that is associated, or only of the parts that a board used when it
+	was last generated, and reports the parts that need attention:
+
+	  discontinued  parts that JLCPCB no longer has
+	  extended      basic or preferred parts that are now extended parts
+	  low-stock     parts with less stock than --min-stock
+
+	Parts that are now extended parts are no longer associated by their
+	values; this can be undone with jcad undo --run, which is printed at
+	the end of the refresh.
+
+	Requests are limited in the same way as other requests to JLCPCB. Each
+	part is updated as soon as it is fetched, so the refresh can be
+	interrupted at any time and run again.
+
+	Example:
+		- jcad refresh
+		- jcad refresh --min-stock 1000 <file.kicad_pcb>`,
+	Args: cobra.MaximumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		pcb := ""
+		if len(args) > 0 {
+			var err error
+			if pcb, err = lib.NormalizePCB(args[0]); err != nil {
+				fmt.Println(err.Error())
+				return
+			}
+		}
+
+		config, err := loadConfig(cmd, pcb)
+		if err != nil {
+			fmt.Printf("failed to load configuration: %s\n", err)
+			return
+		}
+
+		if config.Offline {
+			fmt.Println("parts cannot be refreshed offline")
+			return
+		}
+
+		library, err := lib.NewConfiguredLibrary(config, true)
+		if err != nil {
+			fmt.Printf("failed to obtain default library: %s\n", err)
+			return
+		}
+
+		run := library.BeginRun(pcb)
+		cids := library.AssociatedCIDs()
+		if pcb != "" {
+			cids = library.BoardCIDs(pcb)
+		}
+		library.Close()
+
+		if len(cids) == 0 {
+			if pcb != "" {
+				fmt.Println("no parts are recorded for the board; run jcad generate first")
+			} else {
+				fmt.Println("no parts are associated")
+			}
+			return
+		}
+
+		/* stop between parts when interrupted */
+		ctx, stop := signal.NotifyContext(cmd.Context(), os.Interrupt)
+		defer stop()
+
+		/*
+			the library is only opened to update each part so that other
+			commands can use the library while the parts are fetched
+		*/
+		client := newJLC(config)
+		changes := []lib.RefreshChange{}
+		refreshed, failed := 0, 0
+		for i, cid := range cids {
+			fmt.Printf("refreshing %s (%d of %d)\n", cid, i+1, len(cids))
+			lc, err := client.RefreshComponentDetail(ctx, cid)
+			if ctx.Err() != nil {
+				fmt.Println("interrupted; run jcad refresh again to refresh the remaining parts")
+				break
+			} else if err != nil && !errors.Is(err, lib.ErrNoDetail) {
+				/* only a part that JLCPCB has no detail for is discontinued */
+				fmt.Printf("failed to load %s: %s\n", cid, err)
+				failed++
+				continue
+			}
+
+			err = updateLibrary(config, func(library *lib.Library) error {
+				library.ContinueRun(pcb, run)
+				found, err := library.RefreshPart(cid, lc, rminStock)
+				changes = append(changes, found...)
+				return err
+			})
+			if err != nil {
+				fmt.Printf("failed to update %s: %s\n", cid, err)
+				return
+			}
+			refreshed++
+		}
+
+		fmt.Printf("%d parts refreshed, %d failed\n", refreshed, failed)
+		if len(changes) == 0 {
+			return
+		}
+
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "CHANGE\tPART\tMPN\tDETAIL\t")
+		for _, change := range changes {
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t\n", change.Kind, change.CID, change.Part, change.Detail)
+		}
+		w.Flush()
+
+		/* extended parts are no longer associated by their values */
+		if library, err := lib.NewConfiguredLibrary(config, true); err == nil {
+			removed := library.History(func(entry *lib.HistoryEntry) bool { return entry.Run == run })
+			library.Close()
+
+			if len(removed) > 0 {
+				fmt.Printf("%d associations removed; undo them with jcad undo --run %s\n", len(removed), run)
+			}
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(refreshCmd)
+
+	refreshCmd.Flags().Int64VarP(&rminStock, "min-stock", "", lib.REFRESH_MIN_STOCK, "report parts with less stock than this")
+}
@@ -0,0 +1,72 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/xoviat/jcad/lib"
+	"github.com/xoviat/jcad/lib/jlctest"
+)
+
+func TestRefreshFailures(t *testing.T) {
+	s, err := jlctest.NewServer("../test-data")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	root := t.TempDir()
+	config := filepath.Join(root, lib.CONFIG_FILE)
+	data := fmt.Sprintf("library: library\njlc:\n  url: %s\n  delay: 0s\n  retries: 0\n  cache: cache\n", s.BaseURL())
+	if err := os.WriteFile(config, []byte(data), 0666); err != nil {
+		t.Fatal(err)
+	}
+
+	previous := cfgFile
+	cfgFile = config
+	defer func() { cfgFile = previous }()
+
+	os.Mkdir(filepath.Join(root, "library"), 0777)
+	library, err := lib.NewLibrary(filepath.Join(root, "library"), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	library.Associate(
+		&lib.BoardComponent{Designator: "C1", Comment: "12p", Package: "C_0402_1005Metric"},
+		&lib.LibraryComponent{ID: 1547, Part: "0402CG120J500NT", Package: "0402", Description: "12pF", Stock: 5},
+	)
+	library.Associate(
+		&lib.BoardComponent{Designator: "U1", Comment: "GONE", Package: "SOIC-8"},
+		&lib.LibraryComponent{ID: 99999999, Part: "GONE", Description: "gone", Stock: 10},
+	)
+	library.Close()
+
+	/* JLCPCB refuses the first request, and does not know the second part */
+	s.Fail("getComponentDetail", http.StatusForbidden)
+	refreshCmd.SetContext(context.Background())
+	refreshCmd.Run(refreshCmd, nil)
+
+	if n := s.Requests("getComponentDetail"); n != 2 {
+		t.Errorf("expected both parts to be requested, got %d requests", n)
+	}
+
+	library, err = lib.NewLibrary(filepath.Join(root, "library"), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer library.Close()
+
+	/* a refused request does not mean that the part is discontinued */
+	if lc := library.Exact("C1547"); lc.Stock != 5 {
+		t.Errorf("expected the stock to be unchanged, got %+v", lc)
+	}
+
+	if lc := library.Exact("C99999999"); lc.Part != "GONE" || lc.Stock != 0 {
+		t.Errorf("expected the unknown part to be discontinued, got %+v", lc)
+	}
+}
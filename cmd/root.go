@@ -22,7 +22,12 @@ import (
 	"github.com/spf13/cobra"
 )
 
-var cfgFile string
+var (
+	cfgFile     string
+	libraryPath string
+	kicadPath   string
+	offline     bool
+)
 
 // rootCmd represents the base command when called without any subcommands
 var rootCmd = &cobra.Command{
@@ -51,7 +56,10 @@ func init() {
 	// Cobra supports persistent flags, which, if defined here,
 	// will be global for your application.
 
-	rootCmd.PersistentFlags().StringVar(&cfgFile, "config", "", "config file (default is $HOME/.cli.yaml)")
+	rootCmd.PersistentFlags().StringVar(&cfgFile, "config", "", "config file (default is jcad.yaml in the local app data folder)")
+	rootCmd.PersistentFlags().StringVar(&libraryPath, "library", "", "directory containing the library database")
+	rootCmd.PersistentFlags().StringVar(&kicadPath, "kicad", "", "KiCad bin directory containing kicad-cli")
+	rootCmd.PersistentFlags().BoolVar(&offline, "offline", false, "only look up parts in the library and the cache of JLCPCB responses")
 
 	// Cobra also supports local flags, which will only run
 	// when this action is called directly.
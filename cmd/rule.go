@@ -0,0 +1,143 @@
+/*
+Copyright © 2023 NAME HERE <EMAIL ADDRESS>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cmd
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/spf13/cobra"
+	"github.com/xoviat/jcad/lib"
+)
+
+var rnew lib.AssociationRule
+
+// ruleCmd represents the rule command
+var ruleCmd = &cobra.Command{
+	Use:   "rule",
+	Short: "Manage the association rules of the library.",
+	Long: `Association rules map every component that matches a designator prefix,
+	value and footprint pattern to a part, so that new footprint variants and
+	values do not each need an association. Exact associations are always
+	checked before rules, and rules with a higher priority are checked first.
+
+	Each pattern is a glob, or a regular expression between slashes, and an
+	omitted pattern matches anything. The part is an LCSC part number, a
+	consigned: or global: reference, or skip.
+
+	Example:
+		- jcad rule add --prefix R --value 10k --footprint 'R_0603_*' C25804
+		- jcad rule add --prefix TP --priority 10 skip
+		- jcad rule list
+		- jcad rule remove 3`,
+}
+
+var ruleAddCmd = &cobra.Command{
+	Use:   "add <part>",
+	Short: "Add an association rule.",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		library, ok := openRuleLibrary(cmd, false)
+		if !ok {
+			return
+		}
+		defer library.Close()
+
+		rnew.CID = args[0]
+		rule, err := library.AddRule(rnew)
+		if err != nil {
+			fmt.Printf("failed to add rule: %s\n", err)
+			return
+		}
+
+		fmt.Printf("added rule %s\n", rule)
+	},
+}
+
+var ruleListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List the association rules in the order that they are checked.",
+	Args:  cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		library, ok := openRuleLibrary(cmd, true)
+		if !ok {
+			return
+		}
+		defer library.Close()
+
+		rules := library.Rules()
+		if len(rules) == 0 {
+			fmt.Println("no rules")
+			return
+		}
+
+		for _, rule := range rules {
+			fmt.Println(rule)
+		}
+	},
+}
+
+var ruleRemoveCmd = &cobra.Command{
+	Use:   "remove <id>",
+	Short: "Remove an association rule.",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		id, err := strconv.ParseUint(args[0], 10, 64)
+		if err != nil {
+			fmt.Printf("invalid rule id: %s\n", args[0])
+			return
+		}
+
+		library, ok := openRuleLibrary(cmd, false)
+		if !ok {
+			return
+		}
+		defer library.Close()
+
+		if err := library.DeleteRule(id); err != nil {
+			fmt.Printf("failed to remove rule: %s\n", err)
+			return
+		}
+
+		fmt.Printf("removed rule #%d\n", id)
+	},
+}
+
+func openRuleLibrary(cmd *cobra.Command, readOnly bool) (*lib.Library, bool) {
+	config, err := loadConfig(cmd, "")
+	if err != nil {
+		fmt.Printf("failed to load configuration: %s\n", err)
+		return nil, false
+	}
+
+	library, err := lib.NewConfiguredLibrary(config, readOnly)
+	if err != nil {
+		fmt.Printf("failed to obtain default library: %s\n", err)
+		return nil, false
+	}
+
+	return library, true
+}
+
+func init() {
+	rootCmd.AddCommand(ruleCmd)
+	ruleCmd.AddCommand(ruleAddCmd, ruleListCmd, ruleRemoveCmd)
+
+	ruleAddCmd.Flags().StringVarP(&rnew.Prefix, "prefix", "", "", "pattern for the designator prefix, e.g. R")
+	ruleAddCmd.Flags().StringVarP(&rnew.Value, "value", "", "", "pattern for the comment or value, e.g. 10k")
+	ruleAddCmd.Flags().StringVarP(&rnew.Footprint, "footprint", "", "", "pattern for the footprint, e.g. R_0603_*")
+	ruleAddCmd.Flags().IntVarP(&rnew.Priority, "priority", "", 0, "rules with a higher priority are checked first")
+}
@@ -0,0 +1,102 @@
+/*
+Copyright © 2023 NAME HERE <EMAIL ADDRESS>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+	"github.com/xoviat/jcad/lib"
+)
+
+var (
+	squery lib.SearchQuery
+	sjson  bool
+)
+
+// searchCmd represents the search command
+var searchCmd = &cobra.Command{
+	Use:   "search",
+	Short: "Search the parts in the local library.",
+	Long: `Search finds parts in the local library without contacting JLCPCB.
+
+	Each word of the query must match the start of a word in the part
+	number, manufacturer, description, category, package or value of the
+	part. Basic parts are listed first, then preferred parts, together with the association keys
+	and boards that already use each part.
+
+	Example:
+		- jcad search 10k 0603
+		- jcad search --value 100n --package 0402 capacitor
+		- jcad search --basic --json stm32`,
+	Run: func(cmd *cobra.Command, args []string) {
+		config, err := loadConfig(cmd, "")
+		if err != nil {
+			fmt.Printf("failed to load configuration: %s\n", err)
+			return
+		}
+
+		library, err := lib.NewConfiguredLibrary(config, true)
+		if err != nil {
+			fmt.Printf("failed to obtain default library: %s\n", err)
+			return
+		}
+		defer library.Close()
+
+		squery.Text = args
+		results := library.Search(squery)
+		if sjson {
+			enc := json.NewEncoder(os.Stdout)
+			enc.SetIndent("", "  ")
+			if err := enc.Encode(results); err != nil {
+				fmt.Printf("failed to encode results: %s\n", err)
+			}
+
+			return
+		}
+
+		if len(results) == 0 {
+			fmt.Println("no parts found")
+			return
+		}
+
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "PART\tTYPE\tPACKAGE\tMPN\tDESCRIPTION\tUSED BY\t")
+		for _, result := range results {
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\t\n",
+				result.Component.CID(), result.Component.TypeName(), result.Component.Package, result.Component.Part,
+				result.Component.Description, strings.Join(append(result.Keys, result.Boards...), ", "),
+			)
+		}
+		w.Flush()
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(searchCmd)
+
+	searchCmd.Flags().StringVarP(&squery.Category, "category", "", "", "only show parts in this category")
+	searchCmd.Flags().StringVarP(&squery.Package, "package", "", "", "only show parts with this package")
+	searchCmd.Flags().StringVarP(&squery.Manufacturer, "manufacturer", "", "", "only show parts from this manufacturer")
+	searchCmd.Flags().StringVarP(&squery.Value, "value", "", "", "only show parts with this value, e.g. 4k7 or 100n")
+	searchCmd.Flags().BoolVarP(&squery.Basic, "basic", "", false, "only show basic parts")
+	searchCmd.Flags().IntVarP(&squery.Limit, "limit", "", 50, "the maximum number of parts to show")
+	searchCmd.Flags().BoolVarP(&sjson, "json", "", false, "write the results as JSON")
+}
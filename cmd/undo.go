@@ -0,0 +1,99 @@
+/*
+Copyright © 2023 NAME HERE <EMAIL ADDRESS>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/spf13/cobra"
+	"github.com/xoviat/jcad/lib"
+)
+
+var urun string
+
+// undoCmd represents the undo command
+var undoCmd = &cobra.Command{
+	Use:   "undo",
+	Short: "Undo changes to component associations.",
+	Long: `Undo reverts the latest change to a component association, or with --run,
+	all of the changes made during one run of jcad generate, which is printed
+	at the end of the run. Use --run last for the latest run.
+
+	A change is not undone if the association has changed since; these
+	conflicts are listed. Undoing is itself recorded in the history.
+
+	Example:
+		- jcad undo
+		- jcad undo --run last
+		- jcad undo --run 20240101-120000.000`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		config, err := loadConfig(cmd, "")
+		if err != nil {
+			fmt.Printf("failed to load configuration: %s\n", err)
+			return
+		}
+
+		library, err := lib.NewConfiguredLibrary(config, false)
+		if err != nil {
+			fmt.Printf("failed to obtain default library: %s\n", err)
+			return
+		}
+		defer library.Close()
+
+		var entries []*lib.HistoryEntry
+		switch urun {
+		case "":
+			if last := library.LastChange(); last != nil {
+				entries = append(entries, last)
+			}
+		case "last":
+			runs := library.History(func(entry *lib.HistoryEntry) bool { return entry.Run != "" && entry.Reverts == 0 })
+			if len(runs) > 0 {
+				urun = runs[len(runs)-1].Run
+			}
+
+			fallthrough
+		default:
+			entries = library.History(func(entry *lib.HistoryEntry) bool {
+				return entry.Run == urun && entry.Reverts == 0 && !entry.Undone
+			})
+		}
+
+		if len(entries) == 0 {
+			fmt.Println("nothing to undo")
+			return
+		}
+
+		conflicts, err := library.Undo(entries)
+		if err != nil {
+			fmt.Printf("failed to undo: %s\n", err)
+			return
+		}
+
+		for _, entry := range conflicts {
+			fmt.Printf("not undone, changed since: %s\n", entry)
+		}
+
+		fmt.Printf("undid %d changes\n", len(entries)-len(conflicts))
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(undoCmd)
+
+	undoCmd.Flags().StringVarP(&urun, "run", "", "", "undo all of the changes made during this run, or last")
+}
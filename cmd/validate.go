@@ -0,0 +1,74 @@
+/*
+Copyright © 2023 NAME HERE <EMAIL ADDRESS>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+	"github.com/xoviat/jcad/lib"
+)
+
+// validateCmd represents the validate command
+var validateCmd = &cobra.Command{
+	Use:   "validate",
+	Short: "Check associated parts against their footprints.",
+	Long: `Validate checks the package of every associated part in the library
+	against the footprint of the association key, for example an R_0603
+	footprint associated with a 0402 part.
+
+	The expected package is determined from the footprint name for basic
+	footprints, and from the package associations otherwise.
+
+	Example:
+		- jcad validate`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		config, err := loadConfig(cmd, "")
+		if err != nil {
+			fmt.Printf("failed to load configuration: %s\n", err)
+			return
+		}
+
+		library, err := lib.NewConfiguredLibrary(config, true)
+		if err != nil {
+			fmt.Printf("failed to obtain default library: %s\n", err)
+			return
+		}
+		defer library.Close()
+
+		mismatches := library.ValidatePackages()
+		if len(mismatches) == 0 {
+			fmt.Println("all associated packages match their footprints")
+			return
+		}
+
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "KEY\tPART\tEXPECTED\tACTUAL\t")
+		for _, mismatch := range mismatches {
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t\n", mismatch.Key, mismatch.CID, mismatch.Expected, mismatch.Actual)
+		}
+		w.Flush()
+
+		fmt.Printf("%d associations do not match their footprints\n", len(mismatches))
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(validateCmd)
+}
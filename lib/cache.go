@@ -0,0 +1,75 @@
+package lib
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+/*
+An on-disk cache of JLCPCB responses
+
+Each response is stored in <dir>/<method>/<hash of the request>.json and
+is used until it is older than the TTL
+*/
+type responseCache struct {
+	dir string
+	ttl time.Duration
+}
+
+func (c *responseCache) path(method string, body []byte) string {
+	sum := sha256.Sum256(body)
+
+	return filepath.Join(c.dir, method, hex.EncodeToString(sum[:])+".json")
+}
+
+/*
+return the cached data of the response to a request, if it has not
+expired or if stale responses are accepted
+*/
+func (c *responseCache) get(method string, body []byte, stale bool) (json.RawMessage, bool) {
+	path := c.path(method, body)
+
+	info, err := os.Stat(path)
+	if err != nil || (!stale && time.Since(info.ModTime()) > c.ttl) {
+		return nil, false
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil || !json.Valid(data) {
+		return nil, false
+	}
+
+	return data, true
+}
+
+/*
+store the data of the response to a request
+*/
+func (c *responseCache) put(method string, body []byte, data json.RawMessage) error {
+	path := c.path(method, body)
+	if err := os.MkdirAll(filepath.Dir(path), 0777); err != nil {
+		return err
+	}
+
+	/* write to a temporary file first so that a reader never sees a partial response */
+	tmp, err := os.CreateTemp(filepath.Dir(path), "*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), path)
+}
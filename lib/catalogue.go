@@ -0,0 +1,203 @@
+package lib
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/xuri/excelize/v2"
+)
+
+/*
+the header names of each column of the JLCPCB parts catalogue, which
+differ between versions of the catalogue
+*/
+var CATALOGUE_COLUMNS = map[string][]string{
+	"cid":          {"LCSC Part", "LCSC Part #", "LCSC", "JLCPCB Part #"},
+	"first":        {"First Category"},
+	"category":     {"Second Category", "Category"},
+	"part":         {"MFR.Part", "MFR Part", "Manufacturer Part", "MPN"},
+	"package":      {"Package", "Footprint"},
+	"manufacturer": {"Manufacturer", "Brand"},
+	"type":         {"Library Type", "Type"},
+	"description":  {"Description"},
+	"datasheet":    {"Datasheet"},
+	"price":        {"Price"},
+	"stock":        {"Stock"},
+}
+
+/*
+Read the parts from a JLCPCB parts catalogue spreadsheet (.xlsx) or CSV file
+
+The header row is found by its LCSC part column, and the other columns are
+optional. The library type of each part is kept so that the basic keys of basic
+and preferred parts are associated when they are loaded, in the same way
+as the basic and preferred parts lists. The whole file is read into memory.
+*/
+func ReadCatalogue(path string) ([]*LibraryComponent, error) {
+	var rows [][]string
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".csv":
+		fp, err := os.Open(path)
+		if err != nil {
+			return nil, err
+		}
+		defer fp.Close()
+
+		rows, err = readCSVRows(fp)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %s: %s", path, err)
+		}
+	case ".xlsx", ".xlsm":
+		f, err := excelize.OpenFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open excel file: %s (%s)", path, err)
+		}
+		defer f.Close()
+
+		rows, err = f.GetRows(f.GetSheetList()[0])
+		if err != nil {
+			return nil, fmt.Errorf("failed to get rows: %s (%s)", path, err)
+		}
+	default:
+		return nil, fmt.Errorf("parts catalogue must be an excel spreadsheet or csv file")
+	}
+
+	return parseCatalogue(rows)
+}
+
+func readCSVRows(r io.Reader) ([][]string, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	reader.LazyQuotes = true
+
+	return reader.ReadAll()
+}
+
+func parseCatalogue(rows [][]string) ([]*LibraryComponent, error) {
+	/* the catalogue may start with a title above the header */
+	header, columns := -1, map[string]int{}
+	for i := 0; i < len(rows) && i < 10 && header < 0; i++ {
+		found := map[string]int{}
+		for j, cell := range rows[i] {
+			for column, names := range CATALOGUE_COLUMNS {
+				for _, name := range names {
+					if _, ok := found[column]; !ok && strings.EqualFold(strings.TrimSpace(cell), name) {
+						found[column] = j
+					}
+				}
+			}
+		}
+
+		if _, ok := found["cid"]; ok {
+			header, columns = i, found
+		}
+	}
+
+	if header < 0 {
+		return nil, fmt.Errorf("no LCSC part column found")
+	}
+
+	cell := func(row []string, column string) string {
+		if j, ok := columns[column]; ok && j < len(row) {
+			return strings.TrimSpace(row[j])
+		}
+
+		return ""
+	}
+
+	components := []*LibraryComponent{}
+	for i, row := range rows[header+1:] {
+		cid := strings.ToUpper(cell(row, "cid"))
+		if cid == "" {
+			continue
+		}
+
+		if !reCID.MatchString(cid) {
+			return nil, fmt.Errorf("row %d: invalid part number %s", header+i+2, cid)
+		}
+
+		component := &LibraryComponent{
+			ID:           FromCID(cid),
+			Category:     cell(row, "category"),
+			Part:         cell(row, "part"),
+			Package:      cell(row, "package"),
+			Manufacturer: cell(row, "manufacturer"),
+			Description:  cell(row, "description"),
+			Datasheet:    cell(row, "datasheet"),
+			Prices:       parsePrices(cell(row, "price")),
+		}
+
+		if component.Category == "" {
+			component.Category = cell(row, "first")
+		}
+
+		if stock, err := strconv.ParseInt(strings.ReplaceAll(cell(row, "stock"), ",", ""), 10, 64); err == nil {
+			component.Stock = stock
+		}
+
+		component.SetType(parseLibraryType(cell(row, "type")))
+		components = append(components, component)
+	}
+
+	return components, nil
+}
+
+/*
+return the library type used by the API for a library type of the catalogue
+*/
+func parseLibraryType(s string) string {
+	switch strings.ToLower(s) {
+	case "basic", "base":
+		return LIBRARY_BASIC
+	case "preferred":
+		return LIBRARY_PREFERRED
+	case "extended", "expand":
+		return LIBRARY_EXTENDED
+	}
+
+	return ""
+}
+
+/*
+parse the price tiers of the catalogue, e.g. 1-9:0.0123,10-99:0.0101,100-:0.008
+*/
+func parsePrices(s string) []LibraryPrice {
+	prices := []LibraryPrice{}
+	for _, tier := range strings.Split(s, ",") {
+		quantities, price, ok := strings.Cut(strings.TrimSpace(tier), ":")
+		if !ok {
+			continue
+		}
+
+		start, end, _ := strings.Cut(quantities, "-")
+
+		p := LibraryPrice{End: -1}
+		var err error
+		if p.Start, err = strconv.Atoi(strings.TrimSpace(start)); err != nil {
+			continue
+		}
+
+		if end = strings.TrimSpace(end); end != "" {
+			if p.End, err = strconv.Atoi(end); err != nil {
+				continue
+			}
+		}
+
+		if p.Price, err = strconv.ParseFloat(strings.TrimSpace(price), 64); err != nil {
+			continue
+		}
+
+		prices = append(prices, p)
+	}
+
+	if len(prices) == 0 {
+		return nil
+	}
+
+	return prices
+}
@@ -0,0 +1,112 @@
+package lib
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/xuri/excelize/v2"
+)
+
+var catalogueRows = [][]string{
+	{"JLCPCB SMT Parts Library"},
+	{"LCSC Part", "First Category", "Second Category", "MFR.Part", "Package", "Solder Joint", "Manufacturer", "Library Type", "Description", "Datasheet", "Price", "Stock"},
+	{"C25804", "Resistors", "Chip Resistor - Surface Mount", "0603WAF1002T5E", "0603", "2", "UNI-ROYAL", "Basic", "10kΩ ±1% 100mW", "https://example.com/C25804.pdf", "20-180:0.0011,200-:0.0009", "4,567,890"},
+	{"C7593", "Clock/Timing", "", "NE555DR", "SOIC-8", "8", "Texas Instruments", "Extended", "timer", "", "1-9:0.2,10-:0.15", "1234"},
+	{"C2040", "Embedded Processors & Controllers", "Microcontroller Units (MCUs/MPUs/SOCs)", "RP2040", "LQFN-56", "57", "Raspberry Pi", "Preferred", "", "", "", ""},
+	{""},
+}
+
+func TestReadCatalogue(t *testing.T) {
+	dir := t.TempDir()
+
+	lines := []string{}
+	for _, row := range catalogueRows {
+		lines = append(lines, `"`+strings.Join(row, `","`)+`"`)
+	}
+
+	csv := filepath.Join(dir, "parts.csv")
+	if err := os.WriteFile(csv, []byte(strings.Join(lines, "\n")), 0666); err != nil {
+		t.Fatal(err)
+	}
+
+	f := excelize.NewFile()
+	for i, row := range catalogueRows {
+		cell, _ := excelize.CoordinatesToCellName(1, i+1)
+		f.SetSheetRow(f.GetSheetName(0), cell, &row)
+	}
+
+	xlsx := filepath.Join(dir, "parts.xlsx")
+	if err := f.SaveAs(xlsx); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, path := range []string{csv, xlsx} {
+		components, err := ReadCatalogue(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if len(components) != 3 {
+			t.Fatalf("%s: expected 3 parts, got %d", path, len(components))
+		}
+
+		resistor, timer, mcu := components[0], components[1], components[2]
+		if resistor.CID() != "C25804" || !resistor.Basic || resistor.LibraryType != "base" || resistor.Stock != 4567890 {
+			t.Errorf("%s: unexpected basic part: %+v", path, resistor)
+		}
+
+		if len(resistor.Prices) != 2 || resistor.Prices[1].Start != 200 || resistor.Prices[1].End != -1 || resistor.UnitPrice(200) != 0.0009 {
+			t.Errorf("%s: unexpected prices: %+v", path, resistor.Prices)
+		}
+
+		if timer.Basic || timer.LibraryType != "expand" || timer.Category != "Clock/Timing" {
+			t.Errorf("%s: unexpected extended part: %+v", path, timer)
+		}
+
+		if mcu.Basic || mcu.LibraryType != "preferred" || mcu.Prices != nil {
+			t.Errorf("%s: unexpected preferred part: %+v", path, mcu)
+		}
+	}
+
+	if _, err := ReadCatalogue(filepath.Join(dir, "parts.txt")); err == nil {
+		t.Errorf("expected an error for an unknown format")
+	}
+
+	if _, err := parseCatalogue([][]string{{"Part", "Package"}}); err == nil {
+		t.Errorf("expected an error without an LCSC part column")
+	}
+}
+
+func TestImportParts(t *testing.T) {
+	components, err := parseCatalogue(catalogueRows)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	library, err := NewLibrary(t.TempDir(), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer library.Close()
+
+	summary, err := library.ImportParts(components)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if summary.Added != 3 {
+		t.Errorf("unexpected summary: %+v", summary)
+	}
+
+	/* the basic part is associated in the same way as the basic parts list */
+	lc := library.FindKnown(&BoardComponent{Designator: "R1", Comment: "10k", Package: "R_0603_1608Metric"})
+	if lc == nil || lc.CID() != "C25804" {
+		t.Errorf("expected the basic part to be associated, got %+v", lc)
+	}
+
+	if lc := library.Exact("C7593"); lc.Part != "NE555DR" || lc.Basic {
+		t.Errorf("unexpected extended part: %+v", lc)
+	}
+}
@@ -0,0 +1,323 @@
+package lib
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+/*
+the name of the configuration file, both for the user and beside the board
+*/
+const CONFIG_FILE = "jcad.yaml"
+
+/*
+Config contains the settings of jcad
+
+The configuration is layered: the user configuration is read first,
+then the project configuration beside the board, then the environment,
+and finally the command line flags. Each layer only overrides the
+settings that it specifies.
+*/
+type Config struct {
+	Library     string        `yaml:"library"`      // the directory containing jcad.db
+	LockTimeout time.Duration `yaml:"lock-timeout"` // how long to wait for another process to release the library
+	Connectors  bool          `yaml:"connectors"`   // whether connectors (J) are assembled
+	Exclude     []string      `yaml:"exclude"`      // designator prefixes that are never assembled
+	KiCad       string        `yaml:"kicad"`        // the KiCad bin directory containing kicad-cli
+	Offline     bool          `yaml:"offline"`      // whether parts are only looked up in the library and cache
+	Output      OutputConfig  `yaml:"output"`
+	JLC         JLCConfig     `yaml:"jlc"`
+}
+
+/*
+The names of the generated files, where {name} is the name of the board
+*/
+type OutputConfig struct {
+	BOM       string `yaml:"bom"`
+	CPL       string `yaml:"cpl"`
+	Consigned string `yaml:"consigned"`
+	Hand      string `yaml:"hand"`
+	Cart      string `yaml:"cart"`
+	Gerbers   string `yaml:"gerbers"`
+	ZIP       string `yaml:"zip"`
+}
+
+/*
+The settings of the JLCPCB client
+*/
+type JLCConfig struct {
+	URL      string         `yaml:"url"`       // the base URL of the component API
+	Delay    *time.Duration `yaml:"delay"`     // the time between requests once the burst is used; 0 for no limit
+	Burst    int            `yaml:"burst"`     // the number of requests that can be made at once
+	PageSize int            `yaml:"page-size"` // the number of results of a search
+	Timeout  time.Duration  `yaml:"timeout"`   // how long to wait for each attempt of a request
+	Retries  *int           `yaml:"retries"`   // how many times to retry a request that failed
+	Cache    string         `yaml:"cache"`     // the directory of cached responses
+	CacheTTL time.Duration  `yaml:"cache-ttl"` // how long responses are cached; 0 to disable the cache
+
+	HTTPClient *http.Client `yaml:"-"` // the client used for requests, e.g. in tests
+}
+
+func DefaultConfig() *Config {
+	return &Config{
+		LockTimeout: LOCK_TIMEOUT,
+		Exclude:     append([]string{}, EXCLUDED_PREFIXES...),
+		Output: OutputConfig{
+			BOM:       "{name}-BOM.csv",
+			CPL:       "{name}-all-pos.csv",
+			Consigned: "{name}-consigned.csv",
+			Hand:      "{name}-handsolder.csv",
+			Cart:      "{name}-lcsc.csv",
+			Gerbers:   "{name}-gerber",
+			ZIP:       "{name}-gerber.zip",
+		},
+		JLC: JLCConfig{CacheTTL: JLC_CACHE_TTL},
+	}
+}
+
+/*
+return the path of the user configuration
+*/
+func UserConfigPath() string {
+	return filepath.Join(GetLocalAppData(), "jcad", CONFIG_FILE)
+}
+
+/*
+return the directory of cached JLCPCB responses if none is configured
+*/
+func DefaultCachePath() string {
+	return filepath.Join(GetLocalAppData(), "jcad", "cache")
+}
+
+/*
+return the path of the project configuration for a board
+*/
+func ProjectConfigPath(pcb string) string {
+	return filepath.Join(filepath.Dir(pcb), CONFIG_FILE)
+}
+
+/*
+Load the configuration from each of the paths in order
+
+Missing files are skipped, and unknown settings are an error so that
+typos are not silently ignored
+*/
+func LoadConfig(paths ...string) (*Config, error) {
+	config := DefaultConfig()
+	for _, path := range paths {
+		if path == "" {
+			continue
+		}
+
+		if err := config.Load(path); err != nil && !os.IsNotExist(err) {
+			return nil, err
+		}
+	}
+
+	return config, nil
+}
+
+/*
+Load a configuration file over the configuration
+
+Unlike LoadConfig, a missing file is an error, e.g. for a file that was
+asked for by name
+*/
+func (c *Config) Load(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	if err := c.merge(filepath.Dir(path), data); err != nil {
+		return fmt.Errorf("failed to read %s: %s", path, err)
+	}
+
+	return nil
+}
+
+/*
+merge a configuration file into the configuration
+
+relative paths are relative to the directory of the file
+*/
+func (c *Config) merge(dir string, data []byte) error {
+	library, kicad, cache := c.Library, c.KiCad, c.JLC.Cache
+	c.Library, c.KiCad, c.JLC.Cache = "", "", ""
+
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	dec.KnownFields(true)
+	if err := dec.Decode(c); err != nil && err != io.EOF {
+		return err
+	}
+
+	resolve := func(path, previous string) string {
+		if path == "" {
+			return previous
+		} else if filepath.IsAbs(path) {
+			return path
+		}
+
+		return filepath.Join(dir, path)
+	}
+
+	c.Library = resolve(c.Library, library)
+	c.KiCad = resolve(c.KiCad, kicad)
+	c.JLC.Cache = resolve(c.JLC.Cache, cache)
+
+	return nil
+}
+
+/*
+Apply the JCAD_* environment variables to the configuration
+*/
+func (c *Config) ApplyEnv(lookup func(string) (string, bool)) error {
+	if val, ok := lookup("JCAD_LIBRARY"); ok && val != "" {
+		c.Library = val
+	}
+
+	if val, ok := lookup("JCAD_LOCK_TIMEOUT"); ok && val != "" {
+		timeout, err := time.ParseDuration(val)
+		if err != nil {
+			return fmt.Errorf("invalid JCAD_LOCK_TIMEOUT: %s", val)
+		}
+
+		c.LockTimeout = timeout
+	}
+
+	if val, ok := lookup("JCAD_CONNECTORS"); ok && val != "" {
+		connectors, err := strconv.ParseBool(val)
+		if err != nil {
+			return fmt.Errorf("invalid JCAD_CONNECTORS: %s", val)
+		}
+
+		c.Connectors = connectors
+	}
+
+	if val, ok := lookup("JCAD_EXCLUDE"); ok {
+		c.Exclude = []string{}
+		for _, prefix := range strings.Split(val, ",") {
+			if prefix = strings.TrimSpace(prefix); prefix != "" {
+				c.Exclude = append(c.Exclude, prefix)
+			}
+		}
+	}
+
+	if val, ok := lookup("JCAD_KICAD"); ok && val != "" {
+		c.KiCad = val
+	}
+
+	if val, ok := lookup("JCAD_OFFLINE"); ok && val != "" {
+		offline, err := strconv.ParseBool(val)
+		if err != nil {
+			return fmt.Errorf("invalid JCAD_OFFLINE: %s", val)
+		}
+
+		c.Offline = offline
+	}
+
+	if val, ok := lookup("JCAD_JLC_URL"); ok && val != "" {
+		c.JLC.URL = val
+	}
+
+	if val, ok := lookup("JCAD_JLC_DELAY"); ok && val != "" {
+		delay, err := time.ParseDuration(val)
+		if err != nil {
+			return fmt.Errorf("invalid JCAD_JLC_DELAY: %s", val)
+		}
+
+		c.JLC.Delay = &delay
+	}
+
+	if val, ok := lookup("JCAD_JLC_TIMEOUT"); ok && val != "" {
+		timeout, err := time.ParseDuration(val)
+		if err != nil {
+			return fmt.Errorf("invalid JCAD_JLC_TIMEOUT: %s", val)
+		}
+
+		c.JLC.Timeout = timeout
+	}
+
+	return nil
+}
+
+/*
+return the output names for the board with the given name
+*/
+func (o OutputConfig) Expand(name string) OutputConfig {
+	expand := func(template string) string {
+		return strings.ReplaceAll(template, "{name}", name)
+	}
+
+	return OutputConfig{
+		BOM:       expand(o.BOM),
+		CPL:       expand(o.CPL),
+		Consigned: expand(o.Consigned),
+		Hand:      expand(o.Hand),
+		Cart:      expand(o.Cart),
+		Gerbers:   expand(o.Gerbers),
+		ZIP:       expand(o.ZIP),
+	}
+}
+
+/*
+return the name of the board for which the template of an output gives the
+file name, e.g. board for {name}-BOM.csv and board-BOM.csv
+*/
+func MatchOutput(template, filename string) (string, bool) {
+	prefix, suffix, ok := strings.Cut(template, "{name}")
+	if !ok || strings.Contains(suffix, "{name}") || len(filename) <= len(prefix)+len(suffix) {
+		return "", false
+	}
+
+	if !strings.HasPrefix(filename, prefix) || !strings.HasSuffix(filename, suffix) {
+		return "", false
+	}
+
+	return filename[len(prefix) : len(filename)-len(suffix)], true
+}
+
+/*
+Open the library given by the configuration
+
+commands that only read the library should open it read-only so that
+they can run at the same time as other commands
+*/
+func NewConfiguredLibrary(config *Config, readOnly bool) (*Library, error) {
+	path := config.Library
+	if path == "" {
+		path = filepath.Join(GetLocalAppData(), "jcad")
+	}
+	os.MkdirAll(path, 0777)
+
+	library, err := OpenLibrary(path, config.Connectors, LibraryOptions{
+		ReadOnly: readOnly,
+		Timeout:  config.LockTimeout,
+	})
+	if err != nil {
+		return nil, err
+	}
+	library.SetExcluded(config.Exclude)
+
+	return library, nil
+}
+
+/*
+Find KiCad at the configured path, or the latest installed version
+*/
+func NewConfiguredKicadInterface(config *Config) (*KiCadInterface, error) {
+	if config.KiCad != "" {
+		return NewKicadInterfaceAt(config.KiCad)
+	}
+
+	return NewKicadInterface()
+}
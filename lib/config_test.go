@@ -0,0 +1,109 @@
+package lib
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestLoadConfig(t *testing.T) {
+	dir := t.TempDir()
+	user := filepath.Join(dir, "user.yaml")
+	project := filepath.Join(dir, "board", CONFIG_FILE)
+	os.MkdirAll(filepath.Dir(project), 0777)
+
+	os.WriteFile(user, []byte(`
+library: lib
+connectors: true
+jlc:
+  delay: 250ms
+  page-size: 50
+`), 0666)
+	os.WriteFile(project, []byte(`
+exclude: [H, SW, TP]
+output:
+  bom: "{name}-jlc-bom.csv"
+`), 0666)
+
+	config, err := LoadConfig(user, project, filepath.Join(dir, "missing.yaml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if config.Library != filepath.Join(dir, "lib") {
+		t.Errorf("library path was not resolved relative to the config: %s", config.Library)
+	}
+
+	if !config.Connectors || len(config.Exclude) != 3 || config.Exclude[2] != "TP" {
+		t.Errorf("unexpected assembly settings: %+v", config)
+	}
+
+	if config.JLC.Delay == nil || *config.JLC.Delay != 250*time.Millisecond || config.JLC.PageSize != 50 {
+		t.Errorf("unexpected jlc settings: %+v", config.JLC)
+	}
+
+	names := config.Output.Expand("board")
+	if names.BOM != "board-jlc-bom.csv" || names.CPL != "board-all-pos.csv" {
+		t.Errorf("unexpected output names: %+v", names)
+	}
+
+	for _, c := range []struct {
+		template, filename, name string
+		ok                       bool
+	}{
+		{"{name}-jlc-bom.csv", "board-jlc-bom.csv", "board", true},
+		{"{name}-jlc-bom.csv", "board-BOM.csv", "", false},
+		{"{name}-jlc-bom.csv", "-jlc-bom.csv", "", false},
+		{"bom-{name}.csv", "bom-my-board.csv", "my-board", true},
+		{"bom.csv", "bom.csv", "", false},
+	} {
+		if name, ok := MatchOutput(c.template, c.filename); name != c.name || ok != c.ok {
+			t.Errorf("MatchOutput(%q, %q) = %q %v, expected %q %v", c.template, c.filename, name, ok, c.name, c.ok)
+		}
+	}
+
+	env := map[string]string{"JCAD_CONNECTORS": "false", "JCAD_EXCLUDE": "H, G", "JCAD_JLC_DELAY": "0s"}
+	err = config.ApplyEnv(func(key string) (string, bool) {
+		val, ok := env[key]
+		return val, ok
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if config.Connectors || len(config.Exclude) != 2 || *config.JLC.Delay != 0 {
+		t.Errorf("environment was not applied: %+v", config)
+	}
+
+	/* a file that is loaded by name must exist */
+	if err := DefaultConfig().Load(filepath.Join(dir, "missing.yaml")); !os.IsNotExist(err) {
+		t.Errorf("expected the missing file to be an error, got %v", err)
+	}
+
+	os.WriteFile(project, []byte("conectors: true\n"), 0666)
+	if _, err := LoadConfig(project); err == nil {
+		t.Errorf("expected unknown setting to be rejected")
+	}
+}
+
+func TestAssembled(t *testing.T) {
+	for _, c := range []struct {
+		designator string
+		connectors bool
+		excluded   []string
+		assembled  bool
+	}{
+		{"R1", false, EXCLUDED_PREFIXES, true},
+		{"J1", false, EXCLUDED_PREFIXES, false},
+		{"J1", true, EXCLUDED_PREFIXES, true},
+		{"SW1", true, EXCLUDED_PREFIXES, false},
+		{"SW1", false, []string{"TP"}, true},
+		{"TP1", false, []string{"TP"}, false},
+	} {
+		bc := BoardComponent{Designator: c.designator}
+		if assembled := bc.Assembled(c.connectors, c.excluded); assembled != c.assembled {
+			t.Errorf("%s.Assembled(%t, %v) = %t", c.designator, c.connectors, c.excluded, assembled)
+		}
+	}
+}
@@ -0,0 +1,161 @@
+package lib
+
+import (
+	"math"
+	"sort"
+	"strings"
+)
+
+/*
+A BOM line with its numeric value
+*/
+type ConsolidationLine struct {
+	Entry *BOMEntry
+	Value float64
+}
+
+/*
+A group of BOM lines with the same category and package and near-equal
+values that could be replaced by a single line
+*/
+type ConsolidationGroup struct {
+	Prefix    string
+	Package   string
+	Lines     []*ConsolidationLine
+	Suggested *LibraryComponent
+}
+
+/*
+return the number of unique lines that would be removed by consolidating the group
+*/
+func (cg ConsolidationGroup) Removable() int {
+	return len(cg.Lines) - 1
+}
+
+/*
+return the package size (e.g. 0603) of a BOM entry, if it can be determined
+*/
+func (entry BOMEntry) PackageSize() string {
+	if entry.Component != nil {
+		if _, ok := BASIC_FP_MAP[entry.Component.Package]; ok {
+			return entry.Component.Package
+		}
+	}
+
+	for size, suffix := range BASIC_FP_MAP {
+		if strings.Contains(entry.Package, suffix) || entry.Package == size {
+			return size
+		}
+	}
+
+	return entry.Package
+}
+
+/*
+Find groups of BOM lines that could be consolidated
+
+Lines are grouped by designator prefix and package size, and lines whose
+values are within the tolerance (e.g. 0.1 for 10%) of each other are
+placed in the same group. For each group, the basic component closest to
+the value of the most used line is suggested.
+*/
+func ConsolidateBOM(bom BOM, basic []*LibraryComponent, tolerance float64) []*ConsolidationGroup {
+	buckets := make(map[string][]*ConsolidationLine)
+	for _, entry := range bom {
+		if len(entry.Designators) == 0 {
+			continue
+		}
+
+		prefix := BoardComponent{Designator: entry.Designators[0]}.Prefix()
+		if _, ok := BASIC_CAT_MAP[prefix]; !ok {
+			continue
+		}
+
+		value, ok := ParseValue(entry.Comment)
+		if entry.Component != nil && entry.Component.Value() != "" {
+			value, ok = ParseValue(entry.Component.Value())
+		}
+		if !ok || value <= 0 {
+			continue
+		}
+
+		key := prefix + ":" + entry.PackageSize()
+		buckets[key] = append(buckets[key], &ConsolidationLine{Entry: entry, Value: value})
+	}
+
+	groups := []*ConsolidationGroup{}
+	for key, lines := range buckets {
+		prefix, pkg, _ := strings.Cut(key, ":")
+
+		sort.Slice(lines, func(i, j int) bool { return lines[i].Value < lines[j].Value })
+		for start := 0; start < len(lines); {
+			end := start + 1
+			for end < len(lines) && lines[end].Value <= lines[start].Value*(1+tolerance) {
+				end++
+			}
+
+			if end-start > 1 {
+				group := &ConsolidationGroup{
+					Prefix:  prefix,
+					Package: pkg,
+					Lines:   lines[start:end],
+				}
+				group.Suggested = group.suggest(basic, tolerance)
+
+				groups = append(groups, group)
+			}
+
+			start = end
+		}
+	}
+
+	sort.Slice(groups, func(i, j int) bool {
+		if groups[i].Prefix != groups[j].Prefix {
+			return groups[i].Prefix < groups[j].Prefix
+		}
+		if groups[i].Package != groups[j].Package {
+			return groups[i].Package < groups[j].Package
+		}
+
+		return groups[i].Lines[0].Value < groups[j].Lines[0].Value
+	})
+
+	return groups
+}
+
+/*
+return the basic component that best covers the group, or nil
+*/
+func (cg *ConsolidationGroup) suggest(basic []*LibraryComponent, tolerance float64) *LibraryComponent {
+	target := cg.Lines[0]
+	for _, line := range cg.Lines {
+		if len(line.Entry.Designators) > len(target.Entry.Designators) {
+			target = line
+		}
+	}
+
+	low := cg.Lines[0].Value / (1 + tolerance)
+	high := cg.Lines[len(cg.Lines)-1].Value * (1 + tolerance)
+
+	var (
+		suggested *LibraryComponent
+		distance  float64
+	)
+	for _, lc := range basic {
+		if lc.Prefix() != cg.Prefix || lc.Package != cg.Package {
+			continue
+		}
+
+		value, ok := ParseValue(lc.Value())
+		if !ok || value < low || value > high {
+			continue
+		}
+
+		d := math.Abs(math.Log(value / target.Value))
+		if suggested == nil || d < distance || (d == distance && lc.ID < suggested.ID) {
+			suggested, distance = lc, d
+		}
+	}
+
+	return suggested
+}
@@ -0,0 +1,58 @@
+package lib
+
+import (
+	"testing"
+)
+
+func TestParseValue(t *testing.T) {
+	for val, expected := range map[string]float64{
+		"10k":   10e3,
+		"4.7u":  4.7e-6,
+		"100nf": 100e-9,
+		"2k2":   2.2e3,
+		"4R7":   4.7,
+		"4.7kΩ": 4.7e3,
+		"120":   120,
+	} {
+		value, ok := ParseValue(val)
+		if !ok || value < expected*0.999 || value > expected*1.001 {
+			t.Errorf("ParseValue(%s) = %g, %t; expected %g", val, value, ok, expected)
+		}
+	}
+
+	if _, ok := ParseValue("STM32F407"); ok {
+		t.Errorf("expected part number not to parse")
+	}
+}
+
+func TestConsolidateBOM(t *testing.T) {
+	bom := BOM{
+		1: {Comment: "4.7k", Package: "R_0402_1005Metric", Designators: []string{"R1"}},
+		2: {Comment: "4.99k", Package: "R_0402_1005Metric", Designators: []string{"R2", "R3"}},
+		3: {Comment: "5.1k", Package: "R_0402_1005Metric", Designators: []string{"R4"}},
+		4: {Comment: "10k", Package: "R_0402_1005Metric", Designators: []string{"R5"}},
+		5: {Comment: "4.7k", Package: "R_0603_1608Metric", Designators: []string{"R6"}},
+		6: {Comment: "100n", Package: "C_0402_1005Metric", Designators: []string{"C1"}},
+	}
+
+	basic := []*LibraryComponent{
+		{ID: 25900, Category: "Chip Resistor - Surface Mount", Package: "0402", Description: "4.7kΩ ±1%"},
+		{ID: 25905, Category: "Chip Resistor - Surface Mount", Package: "0402", Description: "5.1kΩ ±1%"},
+		{ID: 23162, Category: "Chip Resistor - Surface Mount", Package: "0603", Description: "4.99kΩ ±1%"},
+	}
+
+	groups := ConsolidateBOM(bom, basic, 0.1)
+	if len(groups) != 1 {
+		t.Fatalf("expected one group, got %d", len(groups))
+	}
+
+	group := groups[0]
+	if group.Prefix != "R" || group.Package != "0402" || group.Removable() != 2 {
+		t.Errorf("unexpected group: %s %s %d", group.Prefix, group.Package, group.Removable())
+	}
+
+	// 4.99k is the most used line and 5.1k is the closest basic part
+	if group.Suggested == nil || group.Suggested.ID != 25905 {
+		t.Errorf("unexpected suggested part: %+v", group.Suggested)
+	}
+}
@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"io"
 	"os"
+	"sort"
 	"strconv"
 	"strings"
 )
@@ -25,25 +26,33 @@ type BoardComponent struct {
 	Layer      string
 }
 
+/*
+Designator prefixes that are not assembled unless configured otherwise
+*/
+var EXCLUDED_PREFIXES = []string{"H", "G", "JP", "DRA", "DS", "SW"}
+
 /*
 Determine whether it is possible to place the component using the SMT process
 */
 func (bc BoardComponent) CanAssemble(connectors bool) bool {
-	switch bc.Prefix() {
-	case "J":
+	return bc.Assembled(connectors, EXCLUDED_PREFIXES)
+}
+
+/*
+Determine whether the component is placed given the excluded designator prefixes
+
+connectors (J) are only placed if connectors is set
+*/
+func (bc BoardComponent) Assembled(connectors bool, excluded []string) bool {
+	prefix := bc.Prefix()
+	if prefix == "J" {
 		return connectors
-	case "H":
-		return false
-	case "G":
-		return false
-	case "JP":
-		return false
-	case "DRA":
-		return false
-	case "DS":
-		return false
-	case "SW":
-		return false
+	}
+
+	for _, e := range excluded {
+		if prefix == e {
+			return false
+		}
 	}
 
 	return true
@@ -96,14 +105,37 @@ func (bc *BoardComponent) Rotate(drotation float64) error {
 
 /*
 AssociationMap acts as an in-memory cache for the DB
+
+If project associations are given, they are checked before the library
 */
 type AssocationMap struct {
 	library     *Library
+	project     *ProjectAssociations
 	assocations map[string]*LibraryComponent
 }
 
 func NewAssociationMap(library *Library) *AssocationMap {
-	return &AssocationMap{library, make(map[string]*LibraryComponent)}
+	return &AssocationMap{library, nil, make(map[string]*LibraryComponent)}
+}
+
+func NewProjectAssociationMap(library *Library, project *ProjectAssociations) *AssocationMap {
+	return &AssocationMap{library, project, make(map[string]*LibraryComponent)}
+}
+
+/*
+return the project association and whether the project has one
+*/
+func (am *AssocationMap) findProject(bcomponent *BoardComponent) (*LibraryComponent, bool) {
+	if am.project == nil {
+		return nil, false
+	}
+
+	cid, ok := am.project.Get(bcomponent.StringKey())
+	if !ok {
+		return nil, false
+	}
+
+	return am.library.Resolve(cid), true
 }
 
 func (am *AssocationMap) FindAssociated(bcomponent *BoardComponent) *LibraryComponent {
@@ -112,22 +144,69 @@ func (am *AssocationMap) FindAssociated(bcomponent *BoardComponent) *LibraryComp
 		return lcomponent
 	}
 
-	lcomponent := am.library.FindAssociated(bcomponent)
+	var lcomponent *LibraryComponent
+	if !am.library.CanAssemble(bcomponent) {
+		lcomponent = &LibraryComponent{}
+	} else if lc, ok := am.findProject(bcomponent); ok {
+		lcomponent = lc
+	} else {
+		lcomponent = am.library.FindAssociated(bcomponent)
+	}
 	am.assocations[key] = lcomponent
 
 	return lcomponent
 }
 
-func (am *AssocationMap) Associate(bcomponent *BoardComponent, lcomponent *LibraryComponent) {
+func (am *AssocationMap) FindKnown(bcomponent *BoardComponent) *LibraryComponent {
+	if lc, ok := am.findProject(bcomponent); ok {
+		return lc
+	}
+
+	return am.library.FindKnown(bcomponent)
+}
+
+/*
+Associate a board component with a library component, or clear the
+association if lcomponent is nil
+
+Keys pinned in the project are updated in the project rather than the
+library, which fails if the project associations cannot be saved
+*/
+func (am *AssocationMap) Associate(bcomponent *BoardComponent, lcomponent *LibraryComponent) error {
 	key := bcomponent.StringKey()
 	if lcomponent == nil {
 		delete(am.assocations, key)
 	}
 
-	am.library.Associate(bcomponent, lcomponent)
+	if _, ok := am.findProject(bcomponent); ok {
+		if lcomponent == nil {
+			am.project.Delete(key)
+		} else {
+			am.library.Store(lcomponent)
+			am.project.Set(key, lcomponent.Reference())
+		}
+
+		if err := am.project.Save(); err != nil {
+			return err
+		}
+	} else {
+		am.library.Associate(bcomponent, lcomponent)
+	}
+
 	if lcomponent != nil {
 		am.assocations[key] = lcomponent
 	}
+
+	return nil
+}
+
+/*
+Replace the data of the component associated with a board component, such
+as after fetching its description, without changing the association
+*/
+func (am *AssocationMap) Load(bcomponent *BoardComponent, lcomponent *LibraryComponent) {
+	am.library.Store(lcomponent)
+	am.assocations[bcomponent.StringKey()] = lcomponent
 }
 
 type BOMEntry struct {
@@ -153,6 +232,100 @@ func (bom BOM) AddComponent(component *BoardComponent, lc *LibraryComponent) {
 	)
 }
 
+/*
+return the number of unique extended parts, each of which has a loading fee
+*/
+func (bom BOM) ExtendedParts() int {
+	n := 0
+	for _, entry := range bom {
+		if entry.Component.Type() == LIBRARY_EXTENDED {
+			n++
+		}
+	}
+
+	return n
+}
+
+/*
+HandBOM groups the components that will not be placed by JLCPCB
+
+Entries are keyed by the board component key because skipped
+components do not necessarily have an associated LCSC part
+*/
+type HandBOM map[string]*BOMEntry
+
+func (bom HandBOM) AddComponent(component *BoardComponent, lc *LibraryComponent) {
+	key := component.StringKey()
+	if _, ok := bom[key]; !ok {
+		bom[key] = &BOMEntry{
+			Comment: component.Comment,
+			Package: component.Package,
+		}
+	}
+
+	if lc != nil && lc.ID != 0 {
+		bom[key].Component = lc
+	}
+
+	bom[key].Designators = append(
+		bom[key].Designators, component.Designator,
+	)
+}
+
+func (bom HandBOM) Keys() []string {
+	keys := make([]string, 0, len(bom))
+	for key := range bom {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	return keys
+}
+
+/*
+ConsignedBOM groups the consigned and globally sourced components
+
+Entries are keyed by the component reference, which contains the MPN
+*/
+type ConsignedBOM map[string]*BOMEntry
+
+func (bom ConsignedBOM) AddComponent(component *BoardComponent, lc *LibraryComponent) {
+	key := lc.Reference()
+	if _, ok := bom[key]; !ok {
+		bom[key] = &BOMEntry{
+			Comment:   component.Comment,
+			Package:   component.Package,
+			Component: lc,
+		}
+	}
+
+	bom[key].Designators = append(
+		bom[key].Designators, component.Designator,
+	)
+}
+
+func (bom ConsignedBOM) Keys() []string {
+	keys := make([]string, 0, len(bom))
+	for key := range bom {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	return keys
+}
+
+/*
+Add an associated component to the consigned BOM if it is consigned or
+globally sourced, or else to the BOM that JLCPCB sources
+*/
+func AddToBOM(bom BOM, consigned ConsignedBOM, component *BoardComponent, lc *LibraryComponent) {
+	if lc.IsSourced() {
+		consigned.AddComponent(component, lc)
+	} else {
+		bom.AddComponent(component, lc)
+	}
+}
+
 /*
 Read a KiCAD POS file produced by kicad-cli export pcb pos
 
@@ -231,15 +404,226 @@ func WriteBOM(dst string, bom BOM) {
 	defer fp.Close()
 
 	writer := csv.NewWriter(fp)
-	writer.Write([]string{"Comment", "Designator", "Footprint", "LCSC Part #"})
+	writer.Write([]string{"Comment", "Designator", "Footprint", "LCSC Part #", "Library Type"})
 	for id, entry := range bom {
 		writer.Write([]string{
 			entry.Comment,
 			strings.Join(entry.Designators, ","),
 			entry.Package,
 			LibraryComponent{ID: id}.CID(),
+			entry.Component.TypeName(),
+		})
+	}
+
+	writer.Flush()
+}
+
+func WriteHandBOM(dst string, bom HandBOM) {
+	fp, err := os.Create(dst)
+	if err != nil {
+		return
+	}
+	defer fp.Close()
+
+	writer := csv.NewWriter(fp)
+	writer.Write([]string{"Comment", "Designator", "Footprint", "Quantity", "LCSC Part #", "Description"})
+	for _, key := range bom.Keys() {
+		entry := bom[key]
+
+		cid, description := "", ""
+		if entry.Component != nil {
+			cid, description = entry.Component.CID(), entry.Component.Description
+		}
+
+		writer.Write([]string{
+			entry.Comment,
+			strings.Join(entry.Designators, ","),
+			entry.Package,
+			strconv.Itoa(len(entry.Designators)),
+			cid,
+			description,
+		})
+	}
+
+	writer.Flush()
+}
+
+/*
+Write a CSV that can be imported into the LCSC cart using the BOM tool
+
+Only entries with a known LCSC part are written
+*/
+func WriteLCSCCart(dst string, bom HandBOM) {
+	fp, err := os.Create(dst)
+	if err != nil {
+		return
+	}
+	defer fp.Close()
+
+	quantities := make(map[string]int)
+	comments := make(map[string]string)
+	cids := []string{}
+	for _, key := range bom.Keys() {
+		entry := bom[key]
+		if entry.Component == nil {
+			continue
+		}
+
+		cid := entry.Component.CID()
+		if _, ok := quantities[cid]; !ok {
+			cids = append(cids, cid)
+			comments[cid] = entry.Comment
+		}
+
+		quantities[cid] += len(entry.Designators)
+	}
+
+	writer := csv.NewWriter(fp)
+	writer.Write([]string{"LCSC Part Number", "Quantity", "Comment"})
+	for _, cid := range cids {
+		writer.Write([]string{cid, strconv.Itoa(quantities[cid]), comments[cid]})
+	}
+
+	writer.Flush()
+}
+
+/*
+Read a BOM written by WriteBOM
+
+The components of the entries only contain the ID
+*/
+func ReadBOM(src string) (BOM, error) {
+	fp, err := os.Open(src)
+	if err != nil {
+		return nil, err
+	}
+	defer fp.Close()
+
+	bom := make(BOM)
+	reader := csv.NewReader(bufio.NewReader(fp))
+	reader.FieldsPerRecord = -1
+	for line, err := reader.Read(); err != io.EOF; line, err = reader.Read() {
+		if err != nil {
+			return nil, err
+		}
+
+		if len(line) < 4 || strings.TrimSpace(line[0]) == "Comment" {
+			continue
+		}
+
+		id := FromCID(strings.TrimSpace(line[3]))
+		bom[id] = &BOMEntry{
+			Comment:     strings.TrimSpace(line[0]),
+			Package:     strings.TrimSpace(line[2]),
+			Designators: strings.Split(strings.TrimSpace(line[1]), ","),
+			Component:   &LibraryComponent{ID: id},
+		}
+	}
+
+	return bom, nil
+}
+
+/*
+Read a CPL written by WriteCPL
+
+The components only contain the designator and placement
+*/
+func ReadCPL(src string) ([]*BoardComponent, error) {
+	fp, err := os.Open(src)
+	if err != nil {
+		return nil, err
+	}
+	defer fp.Close()
+
+	components := []*BoardComponent{}
+	reader := csv.NewReader(bufio.NewReader(fp))
+	reader.FieldsPerRecord = -1
+	for line, err := reader.Read(); err != io.EOF; line, err = reader.Read() {
+		if err != nil {
+			return nil, err
+		}
+
+		if len(line) < 5 || strings.TrimSpace(line[0]) == "Designator" {
+			continue
+		}
+
+		x, _ := strconv.ParseFloat(strings.TrimSpace(line[1]), 64)
+		y, _ := strconv.ParseFloat(strings.TrimSpace(line[2]), 64)
+		rotation, _ := strconv.ParseFloat(strings.TrimSpace(line[4]), 64)
+
+		components = append(components, &BoardComponent{
+			Designator: strings.TrimSpace(line[0]),
+			X:          x,
+			Y:          y,
+			Rotation:   rotation,
+			Layer:      strings.TrimSpace(line[3]),
+		})
+	}
+
+	return components, nil
+}
+
+/*
+Write the consigned and globally sourced components
+
+JLCPCB matches these by manufacturer part number rather than LCSC part number
+*/
+func WriteConsignedBOM(dst string, bom ConsignedBOM) {
+	fp, err := os.Create(dst)
+	if err != nil {
+		return
+	}
+	defer fp.Close()
+
+	writer := csv.NewWriter(fp)
+	writer.Write([]string{"Comment", "Designator", "Footprint", "Manufacturer Part #", "Sourcing"})
+	for _, key := range bom.Keys() {
+		entry := bom[key]
+		writer.Write([]string{
+			entry.Comment,
+			strings.Join(entry.Designators, ","),
+			entry.Package,
+			entry.Component.Part,
+			entry.Component.Sourcing,
 		})
 	}
 
 	writer.Flush()
 }
+
+/*
+Read a consigned BOM written by WriteConsignedBOM
+*/
+func ReadConsignedBOM(src string) (ConsignedBOM, error) {
+	fp, err := os.Open(src)
+	if err != nil {
+		return nil, err
+	}
+	defer fp.Close()
+
+	bom := make(ConsignedBOM)
+	reader := csv.NewReader(bufio.NewReader(fp))
+	reader.FieldsPerRecord = -1
+	for line, err := reader.Read(); err != io.EOF; line, err = reader.Read() {
+		if err != nil {
+			return nil, err
+		}
+
+		if len(line) < 5 || strings.TrimSpace(line[0]) == "Comment" {
+			continue
+		}
+
+		lc := &LibraryComponent{
+			Part:     strings.TrimSpace(line[3]),
+			Sourcing: strings.TrimSpace(line[4]),
+		}
+		bom[lc.Reference()] = &BOMEntry{
+			Comment:     strings.TrimSpace(line[0]),
+			Package:     strings.TrimSpace(line[2]),
+			Designators: strings.Split(strings.TrimSpace(line[1]), ","),
+			Component:   lc,
+		}
+	}
+
+	return bom, nil
+}
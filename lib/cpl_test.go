@@ -0,0 +1,119 @@
+package lib
+
+import (
+	"encoding/csv"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+/*
+return the rows of a CSV file written by the BOM writers
+*/
+func readTestCSV(t *testing.T, path string) [][]string {
+	fp, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fp.Close()
+
+	rows, err := csv.NewReader(fp).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return rows
+}
+
+func TestHandBOM(t *testing.T) {
+	usb := &LibraryComponent{ID: 2765186, Part: "USB4105-GF-A", Description: "USB-C receptacle"}
+	header := &LibraryComponent{ID: 124375, Part: "PZ254V-11-04P", Description: "2.54mm header"}
+
+	hand := make(HandBOM)
+	hand.AddComponent(&BoardComponent{Designator: "J1", Comment: "USB_C", Package: "USB_C_Receptacle"}, usb)
+	hand.AddComponent(&BoardComponent{Designator: "J2", Comment: "USB_C", Package: "USB_C_Receptacle"}, nil)
+	hand.AddComponent(&BoardComponent{Designator: "J3", Comment: "Conn_01x04", Package: "PinHeader_1x04"}, header)
+	hand.AddComponent(&BoardComponent{Designator: "J4", Comment: "Conn_01x04_Alt", Package: "PinHeader_1x04"}, header)
+	hand.AddComponent(&BoardComponent{Designator: "TP1", Comment: "TestPoint", Package: "TestPoint_Pad"}, &LibraryComponent{})
+
+	/* components with the same key are grouped, keeping the part of any of them */
+	if len(hand) != 4 {
+		t.Fatalf("unexpected entries: %v", hand.Keys())
+	}
+
+	entry := hand["J:USB_C:USB_C_Receptacle"]
+	if entry == nil || entry.Component != usb || !reflect.DeepEqual(entry.Designators, []string{"J1", "J2"}) {
+		t.Errorf("unexpected entry: %+v", entry)
+	}
+
+	dir := t.TempDir()
+	WriteHandBOM(filepath.Join(dir, "hand.csv"), hand)
+
+	expected := [][]string{
+		{"Comment", "Designator", "Footprint", "Quantity", "LCSC Part #", "Description"},
+		{"Conn_01x04", "J3", "PinHeader_1x04", "1", "C124375", "2.54mm header"},
+		{"Conn_01x04_Alt", "J4", "PinHeader_1x04", "1", "C124375", "2.54mm header"},
+		{"USB_C", "J1,J2", "USB_C_Receptacle", "2", "C2765186", "USB-C receptacle"},
+		{"TestPoint", "TP1", "TestPoint_Pad", "1", "", ""},
+	}
+	if rows := readTestCSV(t, filepath.Join(dir, "hand.csv")); !reflect.DeepEqual(rows, expected) {
+		t.Errorf("unexpected hand BOM:\n%v\nexpected:\n%v", rows, expected)
+	}
+
+	/* the cart adds up the quantities of each part, and leaves out unknown parts */
+	WriteLCSCCart(filepath.Join(dir, "cart.csv"), hand)
+
+	expected = [][]string{
+		{"LCSC Part Number", "Quantity", "Comment"},
+		{"C124375", "2", "Conn_01x04"},
+		{"C2765186", "2", "USB_C"},
+	}
+	if rows := readTestCSV(t, filepath.Join(dir, "cart.csv")); !reflect.DeepEqual(rows, expected) {
+		t.Errorf("unexpected cart:\n%v\nexpected:\n%v", rows, expected)
+	}
+}
+
+func TestConsignedBOM(t *testing.T) {
+	bom := make(BOM)
+	consigned := make(ConsignedBOM)
+
+	AddToBOM(bom, consigned, &BoardComponent{Designator: "R1", Comment: "10k", Package: "R_0402_1005Metric"}, &LibraryComponent{ID: 25744})
+	AddToBOM(bom, consigned, &BoardComponent{Designator: "J1", Comment: "USB_C", Package: "USB_C_Receptacle"}, ParseSourced("consigned:USB4105-GF-A"))
+	AddToBOM(bom, consigned, &BoardComponent{Designator: "J2", Comment: "USB_C", Package: "USB_C_Receptacle"}, ParseSourced("consigned:USB4105-GF-A"))
+	AddToBOM(bom, consigned, &BoardComponent{Designator: "U1", Comment: "STM32F405", Package: "LQFP-64"}, ParseSourced("global:STM32F405RGT6"))
+
+	/* consigned and globally sourced components are left out of the JLCPCB BOM */
+	dir := t.TempDir()
+	WriteBOM(filepath.Join(dir, "bom.csv"), bom)
+
+	jlc, err := ReadBOM(filepath.Join(dir, "bom.csv"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(jlc) != 1 || jlc[25744] == nil || !reflect.DeepEqual(jlc[25744].Designators, []string{"R1"}) {
+		t.Errorf("unexpected BOM: %+v", jlc)
+	}
+
+	WriteConsignedBOM(filepath.Join(dir, "consigned.csv"), consigned)
+
+	expected := [][]string{
+		{"Comment", "Designator", "Footprint", "Manufacturer Part #", "Sourcing"},
+		{"USB_C", "J1,J2", "USB_C_Receptacle", "USB4105-GF-A", "consigned"},
+		{"STM32F405", "U1", "LQFP-64", "STM32F405RGT6", "global"},
+	}
+	if rows := readTestCSV(t, filepath.Join(dir, "consigned.csv")); !reflect.DeepEqual(rows, expected) {
+		t.Errorf("unexpected consigned BOM:\n%v\nexpected:\n%v", rows, expected)
+	}
+
+	/* the consigned BOM reads back as it was written */
+	read, err := ReadConsignedBOM(filepath.Join(dir, "consigned.csv"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !reflect.DeepEqual(read, consigned) {
+		t.Errorf("unexpected consigned BOM: %+v", read)
+	}
+}
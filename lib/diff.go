@@ -0,0 +1,332 @@
+package lib
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strings"
+)
+
+/*
+Represents a placed component with its associated LCSC part, if any
+*/
+type AssemblyComponent struct {
+	BoardComponent
+	CID string
+}
+
+/*
+Assembly contains the components to be placed, keyed by designator
+*/
+type Assembly map[string]*AssemblyComponent
+
+/*
+Create an assembly from the components of a board using the existing associations
+
+Components that are skipped are not included; components that have not
+been associated are included without a CID
+*/
+func NewAssembly(components []*BoardComponent, am *AssocationMap) Assembly {
+	assembly := make(Assembly)
+	for _, component := range components {
+		ac := &AssemblyComponent{BoardComponent: *component}
+		if lc := am.FindAssociated(component); lc != nil && lc.IsSkipped() {
+			continue
+		} else if lc != nil {
+			ac.CID = lc.Reference()
+		}
+
+		assembly[component.Designator] = ac
+	}
+
+	return assembly
+}
+
+/*
+Create an assembly from a previously generated BOM and CPL
+
+The consigned BOM is optional and is only read if it exists
+*/
+func ReadAssembly(bom, cpl, consigned string) (Assembly, error) {
+	entries, err := ReadBOM(bom)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read bom: %s", err)
+	}
+
+	components, err := ReadCPL(cpl)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read cpl: %s", err)
+	}
+
+	assembly := make(Assembly)
+	for _, component := range components {
+		assembly[component.Designator] = &AssemblyComponent{BoardComponent: *component}
+	}
+
+	lines := []*BOMEntry{}
+	for _, entry := range entries {
+		lines = append(lines, entry)
+	}
+
+	if Exists(consigned) {
+		centries, err := ReadConsignedBOM(consigned)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read consigned bom: %s", err)
+		}
+
+		for _, entry := range centries {
+			lines = append(lines, entry)
+		}
+	}
+
+	for _, entry := range lines {
+		for _, designator := range entry.Designators {
+			ac, ok := assembly[designator]
+			if !ok {
+				ac = &AssemblyComponent{BoardComponent: BoardComponent{Designator: designator}}
+				assembly[designator] = ac
+			}
+
+			ac.Comment = entry.Comment
+			ac.Package = entry.Package
+			ac.CID = entry.Component.Reference()
+		}
+	}
+
+	return assembly, nil
+}
+
+func (a Assembly) Designators() []string {
+	designators := make([]string, 0, len(a))
+	for designator := range a {
+		designators = append(designators, designator)
+	}
+	sort.Strings(designators)
+
+	return designators
+}
+
+/*
+return the designators for each CID
+*/
+func (a Assembly) Lines() map[string][]string {
+	lines := make(map[string][]string)
+	for _, designator := range a.Designators() {
+		cid := a[designator].CID
+		lines[cid] = append(lines[cid], designator)
+	}
+
+	return lines
+}
+
+type DiffComponent struct {
+	Designator string `json:"designator"`
+	Comment    string `json:"comment"`
+	Package    string `json:"package"`
+	CID        string `json:"cid"`
+}
+
+type DiffPart struct {
+	Designator string `json:"designator"`
+	OldCID     string `json:"old_cid"`
+	NewCID     string `json:"new_cid"`
+	OldComment string `json:"old_comment"`
+	NewComment string `json:"new_comment"`
+}
+
+type DiffPlacement struct {
+	Designator  string  `json:"designator"`
+	OldX        float64 `json:"old_x"`
+	OldY        float64 `json:"old_y"`
+	NewX        float64 `json:"new_x"`
+	NewY        float64 `json:"new_y"`
+	OldRotation float64 `json:"old_rotation"`
+	NewRotation float64 `json:"new_rotation"`
+	OldLayer    string  `json:"old_layer"`
+	NewLayer    string  `json:"new_layer"`
+}
+
+type DiffLine struct {
+	CID            string   `json:"cid"`
+	OldDesignators []string `json:"old_designators"`
+	NewDesignators []string `json:"new_designators"`
+}
+
+/*
+AssemblyDiff contains the differences between two assemblies
+*/
+type AssemblyDiff struct {
+	Added   []DiffComponent `json:"added"`
+	Removed []DiffComponent `json:"removed"`
+	Changed []DiffPart      `json:"changed"`
+	Moved   []DiffPlacement `json:"moved"`
+	Rotated []DiffPlacement `json:"rotated"`
+	Lines   []DiffLine      `json:"bom"`
+}
+
+func (d *AssemblyDiff) Empty() bool {
+	return len(d.Added) == 0 && len(d.Removed) == 0 && len(d.Changed) == 0 &&
+		len(d.Moved) == 0 && len(d.Rotated) == 0 && len(d.Lines) == 0
+}
+
+const (
+	diffPositionTolerance = 0.001 // mm
+	diffRotationTolerance = 0.1   // degrees
+)
+
+/*
+Compare two assemblies
+
+Components are matched by designator
+*/
+func DiffAssembly(before, after Assembly) *AssemblyDiff {
+	diff := &AssemblyDiff{}
+
+	for _, designator := range after.Designators() {
+		if _, ok := before[designator]; !ok {
+			diff.Added = append(diff.Added, after[designator].diffComponent())
+		}
+	}
+
+	for _, designator := range before.Designators() {
+		oc := before[designator]
+		nc, ok := after[designator]
+		if !ok {
+			diff.Removed = append(diff.Removed, oc.diffComponent())
+			continue
+		}
+
+		if oc.CID != nc.CID {
+			diff.Changed = append(diff.Changed, DiffPart{
+				Designator: designator,
+				OldCID:     oc.CID,
+				NewCID:     nc.CID,
+				OldComment: oc.Comment,
+				NewComment: nc.Comment,
+			})
+		}
+
+		placement := DiffPlacement{
+			Designator:  designator,
+			OldX:        oc.X,
+			OldY:        oc.Y,
+			NewX:        nc.X,
+			NewY:        nc.Y,
+			OldRotation: oc.Rotation,
+			NewRotation: nc.Rotation,
+			OldLayer:    oc.Layer,
+			NewLayer:    nc.Layer,
+		}
+
+		if math.Abs(oc.X-nc.X) > diffPositionTolerance ||
+			math.Abs(oc.Y-nc.Y) > diffPositionTolerance || oc.Layer != nc.Layer {
+			diff.Moved = append(diff.Moved, placement)
+		}
+
+		if drotation := math.Mod(math.Abs(oc.Rotation-nc.Rotation), 360); drotation > diffRotationTolerance &&
+			360-drotation > diffRotationTolerance {
+			diff.Rotated = append(diff.Rotated, placement)
+		}
+	}
+
+	olines, nlines := before.Lines(), after.Lines()
+	cids := []string{}
+	for cid := range olines {
+		cids = append(cids, cid)
+	}
+	for cid := range nlines {
+		if _, ok := olines[cid]; !ok {
+			cids = append(cids, cid)
+		}
+	}
+	sort.Strings(cids)
+
+	for _, cid := range cids {
+		if strings.Join(olines[cid], ",") != strings.Join(nlines[cid], ",") {
+			diff.Lines = append(diff.Lines, DiffLine{
+				CID:            cid,
+				OldDesignators: olines[cid],
+				NewDesignators: nlines[cid],
+			})
+		}
+	}
+
+	return diff
+}
+
+func (ac AssemblyComponent) diffComponent() DiffComponent {
+	return DiffComponent{
+		Designator: ac.Designator,
+		Comment:    ac.Comment,
+		Package:    ac.Package,
+		CID:        ac.CID,
+	}
+}
+
+/*
+Write a human readable summary of the differences
+*/
+func (d *AssemblyDiff) WriteText(w io.Writer) {
+	if d.Empty() {
+		fmt.Fprintln(w, "no assembly changes")
+		return
+	}
+
+	if len(d.Added) > 0 {
+		fmt.Fprintln(w, "Added designators:")
+		for _, c := range d.Added {
+			fmt.Fprintf(w, "  + %s (%s, %s, %s)\n", c.Designator, c.Comment, c.Package, cidOrNone(c.CID))
+		}
+	}
+
+	if len(d.Removed) > 0 {
+		fmt.Fprintln(w, "Removed designators:")
+		for _, c := range d.Removed {
+			fmt.Fprintf(w, "  - %s (%s, %s, %s)\n", c.Designator, c.Comment, c.Package, cidOrNone(c.CID))
+		}
+	}
+
+	if len(d.Changed) > 0 {
+		fmt.Fprintln(w, "Changed parts:")
+		for _, c := range d.Changed {
+			fmt.Fprintf(w, "  ~ %s: %s -> %s (%s -> %s)\n",
+				c.Designator, cidOrNone(c.OldCID), cidOrNone(c.NewCID), c.OldComment, c.NewComment,
+			)
+		}
+	}
+
+	if len(d.Moved) > 0 {
+		fmt.Fprintln(w, "Moved components:")
+		for _, p := range d.Moved {
+			fmt.Fprintf(w, "  %s: (%1.4f, %1.4f, %s) -> (%1.4f, %1.4f, %s)\n",
+				p.Designator, p.OldX, p.OldY, p.OldLayer, p.NewX, p.NewY, p.NewLayer,
+			)
+		}
+	}
+
+	if len(d.Rotated) > 0 {
+		fmt.Fprintln(w, "Rotated components:")
+		for _, p := range d.Rotated {
+			fmt.Fprintf(w, "  %s: %1.0f -> %1.0f\n", p.Designator, p.OldRotation, p.NewRotation)
+		}
+	}
+
+	if len(d.Lines) > 0 {
+		fmt.Fprintln(w, "BOM line changes:")
+		for _, l := range d.Lines {
+			fmt.Fprintf(w, "  %s: %d -> %d [%s] -> [%s]\n",
+				cidOrNone(l.CID), len(l.OldDesignators), len(l.NewDesignators),
+				strings.Join(l.OldDesignators, ","), strings.Join(l.NewDesignators, ","),
+			)
+		}
+	}
+}
+
+func cidOrNone(cid string) string {
+	if cid == "" {
+		return "unassociated"
+	}
+
+	return cid
+}
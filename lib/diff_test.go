@@ -0,0 +1,54 @@
+package lib
+
+import (
+	"testing"
+)
+
+func TestDiffAssembly(t *testing.T) {
+	before, err := ReadAssembly(
+		"../test-data/STM32F4_Breakout-BOM.csv", "../test-data/STM32F4_Breakout-all-pos.csv", "",
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if diff := DiffAssembly(before, before); !diff.Empty() {
+		t.Fatalf("expected no changes: %+v", diff)
+	}
+
+	after, _ := ReadAssembly(
+		"../test-data/STM32F4_Breakout-BOM.csv", "../test-data/STM32F4_Breakout-all-pos.csv", "",
+	)
+
+	after["C1"].X += 1
+	after["C2"].Rotation += 90
+	after["C3"].CID = "C15850"
+	delete(after, "C4")
+	after["R99"] = &AssemblyComponent{BoardComponent: BoardComponent{Designator: "R99"}, CID: "C25744"}
+
+	diff := DiffAssembly(before, after)
+	if len(diff.Moved) != 1 || diff.Moved[0].Designator != "C1" {
+		t.Errorf("unexpected moved components: %+v", diff.Moved)
+	}
+
+	if len(diff.Rotated) != 1 || diff.Rotated[0].Designator != "C2" {
+		t.Errorf("unexpected rotated components: %+v", diff.Rotated)
+	}
+
+	if len(diff.Changed) != 1 || diff.Changed[0].NewCID != "C15850" {
+		t.Errorf("unexpected changed components: %+v", diff.Changed)
+	}
+
+	if len(diff.Removed) != 1 || diff.Removed[0].Designator != "C4" {
+		t.Errorf("unexpected removed components: %+v", diff.Removed)
+	}
+
+	if len(diff.Added) != 1 || diff.Added[0].Designator != "R99" {
+		t.Errorf("unexpected added components: %+v", diff.Added)
+	}
+
+	// C19702 loses C3, C15850 gains C3, C1525 loses C4 and C25744 is new
+	if len(diff.Lines) != 4 {
+		t.Errorf("unexpected bom line changes: %+v", diff.Lines)
+	}
+}
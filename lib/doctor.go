@@ -0,0 +1,247 @@
+package lib
+
+import (
+	"bytes"
+	"errors"
+	"sort"
+	"strings"
+
+	"github.com/boltdb/bolt"
+)
+
+const (
+	ISSUE_MISSING    = "missing"      // an association refers to a part without a component record
+	ISSUE_INCOMPLETE = "incomplete"   // a component record without a description
+	ISSUE_BASIC      = "stale-basic"  // a basic or preferred part that is no longer associated with its basic key
+	ISSUE_KEY        = "invalid-key"  // an association key that does not follow the naming rules
+	ISSUE_VALUE      = "invalid-part" // an association to something that is not a part
+	ISSUE_INDEX      = "orphan-index" // a search index entry for a part without a component record
+)
+
+/*
+the categories of issues in the order that they are reported
+*/
+var ISSUE_KINDS = []string{ISSUE_MISSING, ISSUE_INCOMPLETE, ISSUE_BASIC, ISSUE_KEY, ISSUE_VALUE, ISSUE_INDEX}
+
+/*
+A problem found in the library
+*/
+type Issue struct {
+	Kind   string
+	Key    string // the association key or search token, if any
+	CID    string
+	Detail string
+}
+
+/*
+return why an association key violates the naming rules, or "" if it is valid
+*/
+func checkKey(key string) string {
+	parts := strings.Split(key, ":")
+	if len(parts) != 3 {
+		return "expected prefix:comment:footprint"
+	}
+
+	prefix, comment, footprint := parts[0], parts[1], parts[2]
+	switch {
+	case prefix == "" || re1.MatchString(prefix):
+		return "prefix must only contain letters"
+	case comment == "":
+		return "empty comment"
+	case footprint == "":
+		return "empty footprint"
+	case (BoardComponent{Designator: prefix, Comment: comment}).IsAbnormal():
+		return "abnormal comment " + comment
+	}
+
+	return ""
+}
+
+/*
+Scan all of the buckets of the library for problems
+*/
+func (l *Library) Diagnose() []Issue {
+	issues := []Issue{}
+	l.db.View(func(tx *bolt.Tx) error {
+		bcomponents := tx.Bucket(COMPONENTS_BKT)
+		bassociations := tx.Bucket(COMPONENTS_ASC_BKT)
+
+		bassociations.ForEach(func(key, val []byte) error {
+			cid := string(val)
+			if detail := checkKey(string(key)); detail != "" {
+				issues = append(issues, Issue{Kind: ISSUE_KEY, Key: string(key), CID: cid, Detail: detail})
+			}
+
+			switch {
+			case cid == "C0" || ParseSourced(cid) != nil:
+			case !reCID.MatchString(cid):
+				issues = append(issues, Issue{Kind: ISSUE_VALUE, Key: string(key), CID: cid, Detail: "not a part number"})
+			case bcomponents.Get(val) == nil:
+				issues = append(issues, Issue{Kind: ISSUE_MISSING, Key: string(key), CID: cid, Detail: "no component record"})
+			}
+
+			return nil
+		})
+
+		bcomponents.ForEach(func(key, val []byte) error {
+			component := LibraryComponent{}
+			if Unmarshal(val, &component) != nil || component.ID == 0 {
+				return nil
+			}
+
+			if component.Description == "" {
+				issues = append(issues, Issue{Kind: ISSUE_INCOMPLETE, CID: string(key), Detail: "no description"})
+			}
+
+			if bkey := component.BasicKey(); bkey != "" {
+				/* a preferred part may share its key with a basic part, which takes precedence */
+				associated := LibraryComponent{}
+				if cid := bassociations.Get([]byte(bkey)); cid != nil && !bytes.Equal(cid, key) &&
+					!(component.Type() == LIBRARY_PREFERRED && Unmarshal(bcomponents.Get(cid), &associated) == nil && associated.Type() == LIBRARY_BASIC) {
+					issues = append(issues, Issue{
+						Kind: ISSUE_BASIC, Key: bkey, CID: string(key), Detail: "basic key is associated with " + string(cid),
+					})
+				}
+			}
+
+			return nil
+		})
+
+		return tx.Bucket(SEARCH_IDX_BKT).ForEach(func(key, val []byte) error {
+			if i := bytes.IndexByte(key, 0); i >= 0 && bcomponents.Get(key[i+1:]) == nil {
+				issues = append(issues, Issue{
+					Kind: ISSUE_INDEX, Key: string(key[:i]), CID: string(key[i+1:]), Detail: "no component record",
+				})
+			}
+
+			return nil
+		})
+	})
+
+	order := make(map[string]int)
+	for i, kind := range ISSUE_KINDS {
+		order[kind] = i
+	}
+
+	sort.SliceStable(issues, func(i, j int) bool {
+		if issues[i].Kind != issues[j].Kind {
+			return order[issues[i].Kind] < order[issues[j].Kind]
+		}
+
+		return issues[i].Key < issues[j].Key
+	})
+
+	return issues
+}
+
+/*
+Fix the issues in the library and return the issues that could not be fixed
+
+Missing and incomplete components are fetched with fetch; an association
+to a part that JLCPCB has no detail for is removed, but one that could not
+be fetched for any other reason, such as an error from JLCPCB or because
+jcad is offline, is left for later. Invalid associations and orphaned index entries are
+removed. Stale basic and preferred parts are fetched again: parts that are
+now extended are updated, and the others take their basic key back unless
+another basic or preferred part has it. Changes to basic keys are recorded
+in the history.
+*/
+func (l *Library) Repair(issues []Issue, fetch func(cid string) (*LibraryComponent, error)) ([]Issue, error) {
+	/* fetch before the transaction so that it is not held open while waiting for JLCPCB */
+	fetched := make(map[string]*LibraryComponent)
+	unknown := make(map[string]bool)
+	for _, issue := range issues {
+		if issue.Kind != ISSUE_MISSING && issue.Kind != ISSUE_INCOMPLETE && issue.Kind != ISSUE_BASIC {
+			continue
+		}
+
+		if _, ok := fetched[issue.CID]; !ok {
+			lc, err := fetch(issue.CID)
+			if err == nil && lc != nil && lc.ID != 0 && lc.Part != "" {
+				fetched[issue.CID] = lc
+			} else {
+				fetched[issue.CID] = nil
+				unknown[issue.CID] = errors.Is(err, ErrNoDetail)
+			}
+		}
+	}
+
+	remaining := []Issue{}
+	err := l.db.Update(func(tx *bolt.Tx) error {
+		bcomponents := tx.Bucket(COMPONENTS_BKT)
+		bassociations := tx.Bucket(COMPONENTS_ASC_BKT)
+
+		for _, issue := range issues {
+			var err error
+			switch issue.Kind {
+			case ISSUE_MISSING:
+				if lc := fetched[issue.CID]; lc != nil {
+					err = putComponent(tx, lc)
+				} else if unknown[issue.CID] {
+					err = bassociations.Delete([]byte(issue.Key))
+				} else {
+					remaining = append(remaining, issue)
+					continue
+				}
+			case ISSUE_INCOMPLETE:
+				lc := fetched[issue.CID]
+				if lc == nil {
+					remaining = append(remaining, issue)
+					continue
+				}
+
+				old := LibraryComponent{}
+				Unmarshal(bcomponents.Get([]byte(issue.CID)), &old)
+				if lc.LibraryType == "" {
+					lc.SetType(old.Type())
+				}
+
+				err = putComponent(tx, lc)
+			case ISSUE_BASIC:
+				/* the library type is only known from the current detail */
+				lc := fetched[issue.CID]
+				if lc == nil || lc.LibraryType == "" {
+					remaining = append(remaining, issue)
+					continue
+				}
+
+				if err := putComponent(tx, lc); err != nil {
+					return err
+				}
+
+				key := lc.BasicKey()
+				if key == "" {
+					continue
+				}
+
+				/* the part takes its key unless another basic or preferred part has it */
+				other := LibraryComponent{}
+				cid := bassociations.Get([]byte(key))
+				if cid != nil && Unmarshal(bcomponents.Get(cid), &other) == nil && other.NoLoadingFee() &&
+					!(lc.Type() == LIBRARY_BASIC && other.Type() == LIBRARY_PREFERRED) {
+					remaining = append(remaining, issue)
+					continue
+				}
+
+				err = l.setBasicKeys(tx, map[string]string{key: issue.CID})
+			case ISSUE_KEY, ISSUE_VALUE:
+				err = bassociations.Delete([]byte(issue.Key))
+			case ISSUE_INDEX:
+				err = tx.Bucket(SEARCH_IDX_BKT).Delete(searchKey(issue.Key, issue.CID))
+			default:
+				remaining = append(remaining, issue)
+			}
+
+			if err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return remaining, nil
+}
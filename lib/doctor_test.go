@@ -0,0 +1,143 @@
+package lib
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/boltdb/bolt"
+)
+
+func TestDiagnose(t *testing.T) {
+	library, err := NewLibrary(t.TempDir(), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer library.Close()
+
+	resistor := func(id int64, basic bool) *LibraryComponent {
+		return &LibraryComponent{
+			ID: id, Category: "Chip Resistor - Surface Mount", Part: "0603WAF1002T5E",
+			Package: "0603", Description: "10kΩ ±1% 100mW", Basic: basic,
+		}
+	}
+
+	library.Store(resistor(25804, true))
+	library.Store(&LibraryComponent{ID: 6186, Part: "AMS1117-3.3"})
+	library.Associate(&BoardComponent{Designator: "R1", Comment: "10k", Package: "R_0603_1608Metric"}, resistor(99999, false))
+
+	library.db.Update(func(tx *bolt.Tx) error {
+		bassociations := tx.Bucket(COMPONENTS_ASC_BKT)
+		bassociations.Put([]byte("U:AP2112K-3.3:SOT-23-5"), []byte("C51118"))
+		bassociations.Put([]byte("R:10K:R_0603_1608Metric"), []byte("C25804"))
+		bassociations.Put([]byte("U:LM358"), []byte("C7950"))
+		bassociations.Put([]byte("U:LM358:SOIC-8"), []byte("LM358"))
+		bassociations.Put([]byte(resistor(25804, true).BasicKey()), []byte("C99999"))
+		tx.Bucket(SEARCH_IDX_BKT).Put(searchKey("ne555", "C7593"), []byte{})
+
+		return nil
+	})
+
+	counts := make(map[string]int)
+	for _, issue := range library.Diagnose() {
+		counts[issue.Kind]++
+	}
+
+	for kind, count := range map[string]int{
+		ISSUE_MISSING: 2, ISSUE_INCOMPLETE: 1, ISSUE_BASIC: 1, ISSUE_KEY: 2, ISSUE_VALUE: 1, ISSUE_INDEX: 1,
+	} {
+		if counts[kind] != count {
+			t.Errorf("expected %d %s issues, got %d", count, kind, counts[kind])
+		}
+	}
+
+	/* an error from JLCPCB does not mean that the part does not exist */
+	remaining, err := library.Repair(library.Diagnose(), func(cid string) (*LibraryComponent, error) {
+		return nil, &APIError{Method: "getComponentDetail", Status: http.StatusForbidden, Message: "forbidden"}
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	counts = make(map[string]int)
+	for _, issue := range remaining {
+		counts[issue.Kind]++
+	}
+
+	if counts[ISSUE_MISSING] != 2 || counts[ISSUE_INCOMPLETE] != 1 {
+		t.Errorf("expected the parts that could not be fetched to remain, got %+v", remaining)
+	}
+
+	library.db.View(func(tx *bolt.Tx) error {
+		if cid := tx.Bucket(COMPONENTS_ASC_BKT).Get([]byte("U:AP2112K-3.3:SOT-23-5")); string(cid) != "C51118" {
+			t.Errorf("expected the association to be kept, got %s", cid)
+		}
+
+		return nil
+	})
+
+	/* the basic part is still basic, so it takes its key back from the extended part */
+	fetched := func(cid string) (*LibraryComponent, error) {
+		switch cid {
+		case "C6186":
+			return &LibraryComponent{ID: 6186, Part: "AMS1117-3.3", Description: "1A LDO"}, nil
+		case "C25804", "C25805":
+			lc := resistor(FromCID(cid), true)
+			lc.SetType(LIBRARY_BASIC)
+			return lc, nil
+		}
+
+		return nil, fmt.Errorf("%w for %s", ErrNoDetail, cid)
+	}
+
+	remaining, err = library.Repair(library.Diagnose(), fetched)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(remaining) != 0 {
+		t.Errorf("unexpected remaining issues: %+v", remaining)
+	}
+
+	if issues := library.Diagnose(); len(issues) != 0 {
+		t.Errorf("unexpected issues after repair: %+v", issues)
+	}
+
+	if lc := library.Exact("C6186"); lc.Description != "1A LDO" {
+		t.Errorf("incomplete component was not fetched: %+v", lc)
+	}
+
+	key := resistor(25804, true).BasicKey()
+	if lc := library.Exact("C25804"); !lc.Basic {
+		t.Errorf("expected the part to stay basic, got %+v", lc)
+	}
+
+	changes := library.History(func(entry *HistoryEntry) bool { return entry.Key == key })
+	if len(changes) == 0 || changes[len(changes)-1].New != "C25804" {
+		t.Errorf("expected the key to be associated with the basic part, got %+v", changes)
+	}
+
+	/* two basic parts with the same key are left alone */
+	library.Store(resistor(25805, true))
+	if remaining, err = library.Repair(library.Diagnose(), fetched); err != nil || len(remaining) != 1 || remaining[0].CID != "C25805" {
+		t.Errorf("expected the issue to remain, got %+v %v", remaining, err)
+	}
+
+	/* until one of them is no longer basic */
+	remaining, err = library.Repair(library.Diagnose(), func(cid string) (*LibraryComponent, error) {
+		lc := resistor(FromCID(cid), false)
+		lc.SetType(LIBRARY_EXTENDED)
+		return lc, nil
+	})
+	if err != nil || len(remaining) != 0 {
+		t.Errorf("unexpected remaining issues: %+v %v", remaining, err)
+	}
+
+	if lc := library.Exact("C25805"); lc.Type() != LIBRARY_EXTENDED {
+		t.Errorf("expected the part to become extended, got %+v", lc)
+	}
+
+	if lc := library.FindAssociated(&BoardComponent{Designator: "R1", Comment: "10k", Package: "R_0603_1608Metric"}); lc == nil || lc.CID() != "C25804" {
+		t.Errorf("expected the basic part to keep its key, got %+v", lc)
+	}
+}
@@ -0,0 +1,367 @@
+package lib
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/boltdb/bolt"
+)
+
+const (
+	RECORD_COMPONENT = "component" // a BoardComponent key associated with a library component
+	RECORD_PACKAGE   = "package"   // a KiCad footprint associated with a JLCPCB package
+
+	RECORD_SKIP = "skip" // the value of a component record that is to be skipped
+)
+
+var reCID *regexp.Regexp = regexp.MustCompile(`^C[0-9]+$`)
+
+/*
+A single association in the text exchange format
+*/
+type AssociationRecord struct {
+	Kind  string
+	Key   string
+	Value string
+}
+
+/*
+return the value stored in the bucket for the record
+*/
+func (r AssociationRecord) stored() string {
+	if r.Kind == RECORD_COMPONENT && r.Value == RECORD_SKIP {
+		return "C0"
+	}
+
+	return r.Value
+}
+
+func newComponentRecord(key, cid string) AssociationRecord {
+	if cid == "C0" {
+		cid = RECORD_SKIP
+	}
+
+	return AssociationRecord{Kind: RECORD_COMPONENT, Key: key, Value: cid}
+}
+
+func (r AssociationRecord) validate() error {
+	if r.Key == "" {
+		return fmt.Errorf("empty key")
+	}
+
+	switch r.Kind {
+	case RECORD_COMPONENT:
+		if r.Value != RECORD_SKIP && !reCID.MatchString(r.Value) && ParseSourced(r.Value) == nil {
+			return fmt.Errorf("invalid part for %s: %s", r.Key, r.Value)
+		}
+	case RECORD_PACKAGE:
+		if r.Value == "" {
+			return fmt.Errorf("empty package for %s", r.Key)
+		}
+	default:
+		return fmt.Errorf("unknown kind: %s", r.Kind)
+	}
+
+	return nil
+}
+
+func sortRecords(records []AssociationRecord) {
+	sort.Slice(records, func(i, j int) bool {
+		if records[i].Kind != records[j].Kind {
+			return records[i].Kind < records[j].Kind
+		}
+
+		return records[i].Key < records[j].Key
+	})
+}
+
+/*
+Write associations in the text exchange format, sorted by kind and key
+
+The format is a CSV file with one association per line so that it can
+be reviewed and merged in version control
+*/
+func WriteAssociations(w io.Writer, records []AssociationRecord) error {
+	sorted := append([]AssociationRecord{}, records...)
+	sortRecords(sorted)
+
+	writer := csv.NewWriter(w)
+	writer.Write([]string{"kind", "key", "value"})
+	for _, record := range sorted {
+		writer.Write([]string{record.Kind, record.Key, record.Value})
+	}
+
+	writer.Flush()
+	return writer.Error()
+}
+
+/*
+Read associations in the text exchange format
+*/
+func ReadAssociations(r io.Reader) ([]AssociationRecord, error) {
+	records := []AssociationRecord{}
+
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	for row, err := reader.Read(); err != io.EOF; row, err = reader.Read() {
+		if err != nil {
+			return nil, err
+		}
+
+		line, _ := reader.FieldPos(0)
+		if len(row) == 1 && strings.TrimSpace(row[0]) == "" {
+			continue
+		}
+
+		if len(row) < 3 {
+			return nil, fmt.Errorf("line %d: expected kind, key and value", line)
+		}
+
+		if strings.TrimSpace(row[0]) == "kind" {
+			continue
+		}
+
+		record := AssociationRecord{
+			Kind:  strings.TrimSpace(row[0]),
+			Key:   strings.TrimSpace(row[1]),
+			Value: strings.TrimSpace(row[2]),
+		}
+		if record.Kind == RECORD_COMPONENT && record.Value == "C0" {
+			record.Value = RECORD_SKIP
+		}
+
+		if err := record.validate(); err != nil {
+			return nil, fmt.Errorf("line %d: %s", line, err)
+		}
+
+		records = append(records, record)
+	}
+
+	return records, nil
+}
+
+/*
+A change to a single association
+*/
+type AssociationChange struct {
+	AssociationRecord
+	Old string
+}
+
+/*
+AssociationDiff contains the changes needed to import a set of associations
+*/
+type AssociationDiff struct {
+	Added   []AssociationChange
+	Changed []AssociationChange
+	Removed []AssociationChange
+	Same    int
+}
+
+/*
+Compare the current associations with the associations to import
+
+Associations of the kinds given in replace that are not present in incoming
+are removed; if no kinds are given, the associations are merged and
+nothing is removed.
+*/
+func DiffAssociations(current, incoming []AssociationRecord, replace ...string) *AssociationDiff {
+	index := func(records []AssociationRecord) map[string]AssociationRecord {
+		m := make(map[string]AssociationRecord)
+		for _, record := range records {
+			m[record.Kind+"\x00"+record.Key] = record
+		}
+
+		return m
+	}
+
+	diff := &AssociationDiff{}
+	mcurrent, mincoming := index(current), index(incoming)
+	for key, record := range mincoming {
+		old, ok := mcurrent[key]
+		if !ok {
+			diff.Added = append(diff.Added, AssociationChange{AssociationRecord: record})
+		} else if old.Value != record.Value {
+			diff.Changed = append(diff.Changed, AssociationChange{AssociationRecord: record, Old: old.Value})
+		} else {
+			diff.Same++
+		}
+	}
+
+	kinds := make(map[string]struct{})
+	for _, kind := range replace {
+		kinds[kind] = struct{}{}
+	}
+
+	for key, record := range mcurrent {
+		if _, ok := kinds[record.Kind]; !ok {
+			continue
+		}
+
+		if _, ok := mincoming[key]; !ok {
+			diff.Removed = append(diff.Removed, AssociationChange{AssociationRecord: record, Old: record.Value})
+		}
+	}
+
+	for _, changes := range [][]AssociationChange{diff.Added, diff.Changed, diff.Removed} {
+		sort.Slice(changes, func(i, j int) bool {
+			if changes[i].Kind != changes[j].Kind {
+				return changes[i].Kind < changes[j].Kind
+			}
+
+			return changes[i].Key < changes[j].Key
+		})
+	}
+
+	return diff
+}
+
+/*
+return the records to write when applying the diff
+
+changed associations are only written if overwrite is set
+*/
+func (d *AssociationDiff) Writes(overwrite bool) []AssociationRecord {
+	records := []AssociationRecord{}
+	for _, change := range d.Added {
+		records = append(records, change.AssociationRecord)
+	}
+
+	if overwrite {
+		for _, change := range d.Changed {
+			records = append(records, change.AssociationRecord)
+		}
+	}
+
+	return records
+}
+
+/*
+Write the diff in a human readable form
+*/
+func (d *AssociationDiff) WriteText(w io.Writer) {
+	for _, change := range d.Added {
+		fmt.Fprintf(w, "+ %s %s: %s\n", change.Kind, change.Key, change.Value)
+	}
+
+	for _, change := range d.Changed {
+		fmt.Fprintf(w, "~ %s %s: %s -> %s\n", change.Kind, change.Key, change.Old, change.Value)
+	}
+
+	for _, change := range d.Removed {
+		fmt.Fprintf(w, "- %s %s: %s\n", change.Kind, change.Key, change.Old)
+	}
+
+	fmt.Fprintf(w, "%d added, %d changed, %d removed, %d unchanged\n",
+		len(d.Added), len(d.Changed), len(d.Removed), d.Same,
+	)
+}
+
+/*
+return all component and package associations in the library
+*/
+func (l *Library) Records() []AssociationRecord {
+	records := []AssociationRecord{}
+	l.db.View(func(tx *bolt.Tx) error {
+		tx.Bucket(COMPONENTS_ASC_BKT).ForEach(func(key, val []byte) error {
+			records = append(records, newComponentRecord(string(key), string(val)))
+			return nil
+		})
+
+		return tx.Bucket(PACKAGE_ASC_BKT).ForEach(func(key, val []byte) error {
+			if len(val) > 0 {
+				records = append(records, AssociationRecord{
+					Kind: RECORD_PACKAGE, Key: string(key), Value: string(val),
+				})
+			}
+
+			return nil
+		})
+	})
+
+	sortRecords(records)
+	return records
+}
+
+/*
+apply the diff to the library in a single transaction
+*/
+func (l *Library) ApplyAssociations(diff *AssociationDiff, overwrite bool) error {
+	bucket := func(kind string) []byte {
+		if kind == RECORD_PACKAGE {
+			return PACKAGE_ASC_BKT
+		}
+
+		return COMPONENTS_ASC_BKT
+	}
+
+	/* component associations that are imported are recorded in the history */
+	history := func(tx *bolt.Tx, kind, key, value string) error {
+		if kind != RECORD_COMPONENT {
+			return nil
+		}
+
+		return l.recordChange(tx, key, string(tx.Bucket(COMPONENTS_ASC_BKT).Get([]byte(key))), value, 0)
+	}
+
+	return l.db.Update(func(tx *bolt.Tx) error {
+		for _, record := range diff.Writes(overwrite) {
+			if err := history(tx, record.Kind, record.Key, record.stored()); err != nil {
+				return err
+			}
+
+			if err := tx.Bucket(bucket(record.Kind)).Put([]byte(record.Key), []byte(record.stored())); err != nil {
+				return err
+			}
+		}
+
+		for _, change := range diff.Removed {
+			if err := history(tx, change.Kind, change.Key, ""); err != nil {
+				return err
+			}
+
+			if err := tx.Bucket(bucket(change.Kind)).Delete([]byte(change.Key)); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+}
+
+/*
+return the project associations as component records
+*/
+func (pa *ProjectAssociations) Records() []AssociationRecord {
+	records := []AssociationRecord{}
+	for _, key := range pa.Keys() {
+		records = append(records, newComponentRecord(key, pa.associations[key]))
+	}
+
+	return records
+}
+
+/*
+apply the component records of the diff and save the project
+
+package associations are global and are ignored
+*/
+func (pa *ProjectAssociations) ApplyAssociations(diff *AssociationDiff, overwrite bool) error {
+	for _, record := range diff.Writes(overwrite) {
+		if record.Kind == RECORD_COMPONENT {
+			pa.Set(record.Key, record.stored())
+		}
+	}
+
+	for _, change := range diff.Removed {
+		if change.Kind == RECORD_COMPONENT {
+			pa.Delete(change.Key)
+		}
+	}
+
+	return pa.Save()
+}
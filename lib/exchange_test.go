@@ -0,0 +1,66 @@
+package lib
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestAssociationExchange(t *testing.T) {
+	library, err := NewLibrary(t.TempDir(), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer library.Close()
+
+	r1 := &BoardComponent{Designator: "R1", Comment: "10k", Package: "R_0402_1005Metric"}
+	j1 := &BoardComponent{Designator: "J1", Comment: "USB_C", Package: "USB_C_Receptacle"}
+	library.Associate(r1, &LibraryComponent{ID: 25744, Package: "0402"})
+	library.Associate(j1, &LibraryComponent{})
+
+	buf := new(bytes.Buffer)
+	if err := WriteAssociations(buf, library.Records()); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := "kind,key,value\n" +
+		"component,J:USB_C:USB_C_Receptacle,skip\n" +
+		"component,R:10k:R_0402_1005Metric,C25744\n" +
+		"package,R_0402_1005Metric,0402\n"
+	if buf.String() != expected {
+		t.Fatalf("unexpected export:\n%s", buf.String())
+	}
+
+	incoming, err := ReadAssociations(strings.NewReader(
+		"kind,key,value\n" +
+			"component,R:10k:R_0402_1005Metric,C25741\n" +
+			"component,C:100n:C_0402_1005Metric,C1525\n",
+	))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	/* merging adds new associations and keeps conflicting ones */
+	diff := DiffAssociations(library.Records(), incoming)
+	if len(diff.Added) != 1 || len(diff.Changed) != 1 || len(diff.Removed) != 0 {
+		t.Fatalf("unexpected merge diff: %+v", diff)
+	}
+
+	if err := library.ApplyAssociations(diff, false); err != nil {
+		t.Fatal(err)
+	}
+
+	if lc := library.FindAssociated(r1); lc == nil || lc.ID != 25744 {
+		t.Errorf("expected conflicting association to be kept: %+v", lc)
+	}
+
+	/* replacing removes associations that are not in the file */
+	diff = DiffAssociations(library.Records(), incoming, RECORD_COMPONENT)
+	if len(diff.Removed) != 1 || diff.Removed[0].Key != string(j1.Key()) {
+		t.Fatalf("unexpected replace diff: %+v", diff)
+	}
+
+	if _, err := ReadAssociations(strings.NewReader("component,R:10k:R_0402,10k\n")); err == nil {
+		t.Errorf("expected invalid part to be rejected")
+	}
+}
@@ -0,0 +1,108 @@
+package lib
+
+import (
+	"context"
+)
+
+/*
+A parametric search of the JLCPCB parts
+
+Empty fields match any part
+*/
+type ComponentQuery struct {
+	Keyword     string
+	Category    string   // the first level category, e.g. Resistors
+	Subcategory string   // the second level category, e.g. Chip Resistor - Surface Mount
+	Package     string   // e.g. 0603
+	LibraryType string   // base, preferred or expand
+	InStock     bool     // only parts that are in stock
+	Brand       string   // the manufacturer
+	Attributes  []string // attribute values, e.g. 10kΩ
+	Page        int      // the page of results, starting at 1
+	PageSize    int      // the number of parts on each page, or 0 for the default
+}
+
+/*
+One page of the parts found by a query
+*/
+type ComponentPage struct {
+	Components []*LibraryComponent // in the order that JLCPCB returned them
+	Page       int
+	HasNext    bool // whether there are more pages
+	Total      int  // the number of parts on all pages, if known
+}
+
+/*
+return whether a part returned for the query matches the filters that
+JLCPCB may not apply itself
+*/
+func (q ComponentQuery) matches(lc *LibraryComponent) bool {
+	if q.InStock && lc.Stock <= 0 {
+		return false
+	}
+
+	if q.LibraryType != "" && lc.Type() != q.LibraryType {
+		return false
+	}
+
+	return true
+}
+
+/*
+Find the parts that match the query, following the pages from query.Page
+until there are none left or limit parts have been found
+
+limit is ignored if it is not positive
+*/
+func FindAll(ctx context.Context, source ComponentSource, query ComponentQuery, limit int) ([]*LibraryComponent, error) {
+	query.Page = max(query.Page, 1)
+
+	components := []*LibraryComponent{}
+	for {
+		page, err := source.FindComponents(ctx, query)
+		if err != nil {
+			return components, err
+		}
+
+		for _, component := range page.Components {
+			if limit > 0 && len(components) >= limit {
+				return components, nil
+			}
+
+			components = append(components, component)
+		}
+
+		if !page.HasNext {
+			return components, nil
+		}
+
+		query.Page++
+	}
+}
+
+/*
+Search for the parts to suggest for a board component
+
+If a package is expected for the footprint, the search is narrowed to
+that package, falling back to the comment alone if nothing is found
+*/
+func SuggestComponents(ctx context.Context, source ComponentSource, library *Library, bcomponent *BoardComponent) (map[int64]*LibraryComponent, error) {
+	if expected := library.ExpectedPackage(bcomponent.Package); expected != "" {
+		page, err := source.FindComponents(ctx, ComponentQuery{Keyword: bcomponent.Comment, Package: expected})
+		if err == nil && len(page.Components) > 0 {
+			components := make(map[int64]*LibraryComponent)
+			for _, component := range page.Components {
+				components[component.ID] = component
+			}
+
+			return library.FilterPackages(bcomponent, components), nil
+		}
+	}
+
+	components, err := source.SelectComponentList(ctx, bcomponent.Comment)
+	if err != nil {
+		return nil, err
+	}
+
+	return library.FilterPackages(bcomponent, components), nil
+}
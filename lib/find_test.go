@@ -0,0 +1,100 @@
+package lib
+
+import (
+	"context"
+	"testing"
+)
+
+func TestFindComponents(t *testing.T) {
+	jlc, s := newTestJLC(t)
+	ctx := context.Background()
+
+	page, err := jlc.FindComponents(ctx, ComponentQuery{Package: "0805", PageSize: 3})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(page.Components) != 3 || !page.HasNext || page.Components[0].CID() != "C15850" {
+		t.Errorf("unexpected first page: %+v", page)
+	}
+
+	/* all of the pages are followed */
+	requests := s.Requests("selectSmtComponentList")
+	components, err := FindAll(ctx, jlc, ComponentQuery{Package: "0805", PageSize: 3}, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(components) != 8 {
+		t.Errorf("expected 8 parts, got %d", len(components))
+	}
+
+	if n := s.Requests("selectSmtComponentList") - requests; n != 3 {
+		t.Errorf("expected 3 pages, got %d", n)
+	}
+
+	/* up to the limit */
+	if components, _ := FindAll(ctx, jlc, ComponentQuery{Package: "0805", PageSize: 3}, 4); len(components) != 4 {
+		t.Errorf("expected 4 parts, got %d", len(components))
+	}
+
+	for _, tc := range []struct {
+		query    ComponentQuery
+		expected int
+	}{
+		{ComponentQuery{Brand: "texas"}, 1},
+		{ComponentQuery{Subcategory: "Zener Diodes", InStock: true}, 2},
+		{ComponentQuery{Keyword: "10kΩ", Package: "1206"}, 1},
+		{ComponentQuery{LibraryType: "expand"}, 0},
+	} {
+		components, err := FindAll(ctx, jlc, tc.query, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if len(components) != tc.expected {
+			t.Errorf("%+v: expected %d parts, got %d", tc.query, tc.expected, len(components))
+		}
+	}
+}
+
+func TestSuggestComponents(t *testing.T) {
+	jlc, s := newTestJLC(t)
+	ctx := context.Background()
+
+	library, err := NewLibrary(t.TempDir(), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer library.Close()
+
+	/* the search is narrowed to the package of the footprint */
+	requests := s.Requests("selectSmtComponentList")
+	suggested, err := SuggestComponents(ctx, jlc, library, &BoardComponent{Designator: "R1", Comment: "300Ω", Package: "R_0805_2012Metric"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(suggested) != 1 || suggested[17617] == nil {
+		t.Errorf("expected C17617, got %v", suggested)
+	}
+
+	if n := s.Requests("selectSmtComponentList") - requests; n != 1 {
+		t.Errorf("expected one search, got %d", n)
+	}
+
+	/* and falls back to the comment alone */
+	requests = s.Requests("selectSmtComponentList")
+	suggested, err = SuggestComponents(ctx, jlc, library, &BoardComponent{Designator: "R1", Comment: "300Ω", Package: "R_0402_1005Metric"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(suggested) != 2 {
+		t.Errorf("expected both 300Ω parts, got %v", suggested)
+	}
+
+	if n := s.Requests("selectSmtComponentList") - requests; n != 2 {
+		t.Errorf("expected two searches, got %d", n)
+	}
+}
@@ -0,0 +1,248 @@
+package lib
+
+import (
+	"encoding/binary"
+	"fmt"
+	"os"
+	"os/user"
+	"sort"
+	"time"
+
+	"github.com/boltdb/bolt"
+)
+
+var (
+	HISTORY_BKT = []byte("association-history") // Contains each change to a component association, in order
+)
+
+/*
+A change to a component association
+
+Old and New are the stored values, or "" if there was no association
+*/
+type HistoryEntry struct {
+	ID      uint64    `json:"id"`
+	Time    time.Time `json:"time"`
+	User    string    `json:"user"`
+	Board   string    `json:"board"`
+	Run     string    `json:"run"`
+	Key     string    `json:"key"`
+	Old     string    `json:"old"`
+	New     string    `json:"new"`
+	Reverts uint64    `json:"reverts,omitempty"` // the entry that this change undoes
+	Undone  bool      `json:"undone,omitempty"`  // whether this change has been undone
+}
+
+func (e *HistoryEntry) String() string {
+	value := func(v string) string {
+		if v == "" {
+			return "(none)"
+		}
+
+		return v
+	}
+
+	s := fmt.Sprintf("#%d %s %s %s: %s -> %s",
+		e.ID, e.Time.Local().Format("2006-01-02 15:04:05"), e.User, e.Key, value(e.Old), value(e.New),
+	)
+	if e.Board != "" {
+		s += " (" + e.Board + ")"
+	}
+
+	if e.Reverts != 0 {
+		s += fmt.Sprintf(" undoes #%d", e.Reverts)
+	} else if e.Undone {
+		s += " [undone]"
+	}
+
+	return s
+}
+
+/*
+The context that changes to the library are recorded with
+*/
+type session struct {
+	user  string
+	board string
+	run   string
+}
+
+/*
+return the name of the user running jcad
+*/
+func currentUser() string {
+	if u, err := user.Current(); err == nil && u.Username != "" {
+		return u.Username
+	}
+
+	for _, env := range []string{"USERNAME", "USER"} {
+		if name := os.Getenv(env); name != "" {
+			return name
+		}
+	}
+
+	return "unknown"
+}
+
+/*
+version 5: changes to associations are recorded in the history
+*/
+func migrateHistory(tx *bolt.Tx) error {
+	_, err := tx.CreateBucketIfNotExists(HISTORY_BKT)
+
+	return err
+}
+
+/*
+Start a run, such as one jcad generate, for a board
+
+All changes until the next run are recorded with the board and the
+returned run ID so that they can be undone together
+*/
+func (l *Library) BeginRun(board string) string {
+	l.session.board = board
+	l.session.run = time.Now().UTC().Format("20060102-150405.000")
+
+	return l.session.run
+}
+
+/*
+Continue a run that was started with BeginRun, such as after the library
+was opened again
+*/
+func (l *Library) ContinueRun(board, run string) {
+	l.session.board = board
+	l.session.run = run
+}
+
+/*
+record a change to an association in the transaction
+*/
+func (l *Library) recordChange(tx *bolt.Tx, key, before, after string, reverts uint64) error {
+	if before == after {
+		return nil
+	}
+
+	bhistory := tx.Bucket(HISTORY_BKT)
+	id, err := bhistory.NextSequence()
+	if err != nil {
+		return err
+	}
+
+	if l.session.user == "" {
+		l.session.user = currentUser()
+	}
+
+	return putHistory(bhistory, &HistoryEntry{
+		ID:      id,
+		Time:    time.Now().UTC(),
+		User:    l.session.user,
+		Board:   l.session.board,
+		Run:     l.session.run,
+		Key:     key,
+		Old:     before,
+		New:     after,
+		Reverts: reverts,
+	})
+}
+
+func putHistory(bhistory *bolt.Bucket, entry *HistoryEntry) error {
+	key := make([]byte, 8)
+	binary.BigEndian.PutUint64(key, entry.ID)
+
+	bytes, err := Marshal(entry)
+	if err != nil {
+		return err
+	}
+
+	return bhistory.Put(key, bytes)
+}
+
+/*
+return the history entries that match, oldest first
+*/
+func (l *Library) History(match func(entry *HistoryEntry) bool) []*HistoryEntry {
+	entries := []*HistoryEntry{}
+	l.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(HISTORY_BKT).ForEach(func(key, val []byte) error {
+			entry := HistoryEntry{}
+			if Unmarshal(val, &entry) == nil && (match == nil || match(&entry)) {
+				entries = append(entries, &entry)
+			}
+
+			return nil
+		})
+	})
+
+	return entries
+}
+
+/*
+return the latest change that can be undone, or nil
+*/
+func (l *Library) LastChange() *HistoryEntry {
+	entries := l.History(func(entry *HistoryEntry) bool {
+		return entry.Reverts == 0 && !entry.Undone
+	})
+	if len(entries) == 0 {
+		return nil
+	}
+
+	return entries[len(entries)-1]
+}
+
+/*
+Undo the changes in reverse order and return the changes that were not
+undone because the association has changed since
+
+Each undo is itself recorded in the history
+*/
+func (l *Library) Undo(entries []*HistoryEntry) ([]*HistoryEntry, error) {
+	sorted := append([]*HistoryEntry{}, entries...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].ID > sorted[j].ID })
+
+	conflicts := []*HistoryEntry{}
+	err := l.db.Update(func(tx *bolt.Tx) error {
+		bassociations := tx.Bucket(COMPONENTS_ASC_BKT)
+		bhistory := tx.Bucket(HISTORY_BKT)
+
+		for _, entry := range sorted {
+			if entry.Undone || entry.Reverts != 0 {
+				continue
+			}
+
+			current := string(bassociations.Get([]byte(entry.Key)))
+			if current != entry.New {
+				conflicts = append(conflicts, entry)
+				continue
+			}
+
+			var err error
+			if entry.Old == "" {
+				err = bassociations.Delete([]byte(entry.Key))
+			} else {
+				err = bassociations.Put([]byte(entry.Key), []byte(entry.Old))
+			}
+			if err != nil {
+				return err
+			}
+
+			if err := l.recordChange(tx, entry.Key, current, entry.Old, entry.ID); err != nil {
+				return err
+			}
+
+			undone := *entry
+			undone.Undone = true
+			if err := putHistory(bhistory, &undone); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return conflicts, nil
+}
@@ -0,0 +1,69 @@
+package lib
+
+import (
+	"testing"
+)
+
+func TestHistory(t *testing.T) {
+	library, err := NewLibrary(t.TempDir(), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer library.Close()
+
+	r1 := &BoardComponent{Designator: "R1", Comment: "10k", Package: "R_0603_1608Metric"}
+	u1 := &BoardComponent{Designator: "U1", Comment: "AMS1117-3.3", Package: "SOT-223-3_TabPin2"}
+
+	library.Associate(r1, &LibraryComponent{ID: 25804})
+
+	run := library.BeginRun("a.kicad_pcb")
+	library.Associate(r1, nil)
+	library.Associate(r1, &LibraryComponent{ID: 25744})
+	library.Associate(u1, &LibraryComponent{ID: 6186})
+	library.Associate(u1, &LibraryComponent{ID: 6186})
+
+	entries := library.History(func(entry *HistoryEntry) bool { return entry.Key == r1.StringKey() })
+	if len(entries) != 3 || entries[0].Old != "" || entries[0].New != "C25804" || entries[0].Run != "" ||
+		entries[2].Old != "" || entries[2].New != "C25744" || entries[2].Board != "a.kicad_pcb" {
+		t.Errorf("unexpected history for %s: %v", r1.StringKey(), entries)
+	}
+
+	if entries[0].User == "" {
+		t.Errorf("expected history to record the user")
+	}
+
+	/* undo the latest change only */
+	conflicts, err := library.Undo([]*HistoryEntry{library.LastChange()})
+	if err != nil || len(conflicts) != 0 {
+		t.Fatalf("failed to undo last change: %v %v", err, conflicts)
+	}
+
+	if lc := library.FindKnown(u1); lc != nil {
+		t.Errorf("expected U1 association to be undone, got %+v", lc)
+	}
+
+	/* undo the rest of the run */
+	conflicts, err = library.Undo(library.History(func(entry *HistoryEntry) bool { return entry.Run == run }))
+	if err != nil || len(conflicts) != 0 {
+		t.Fatalf("failed to undo run: %v %v", err, conflicts)
+	}
+
+	if lc := library.FindKnown(r1); lc == nil || lc.CID() != "C25804" {
+		t.Errorf("expected R1 to be restored to C25804, got %+v", lc)
+	}
+
+	if last := library.LastChange(); last == nil || last.New != "C25804" || last.Run != "" {
+		t.Errorf("unexpected last change after undo: %v", last)
+	}
+
+	/* a change that has been overwritten since is not undone */
+	library.BeginRun("b.kicad_pcb")
+	library.Associate(u1, &LibraryComponent{ID: 6186})
+	change := library.LastChange()
+	library.Associate(u1, &LibraryComponent{ID: 51118})
+
+	conflicts, err = library.Undo([]*HistoryEntry{change})
+	if err != nil || len(conflicts) != 1 {
+		t.Errorf("expected conflict, got %v %v", err, conflicts)
+	}
+}
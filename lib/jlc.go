@@ -1,37 +1,182 @@
 package lib
 
 import (
-	"bufio"
+	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"io"
 	"net/http"
-	"sync"
+	"net/url"
+	"strconv"
+	"strings"
 	"time"
 )
 
+const (
+	JLC_URL       = "https://jlcpcb.com/api/overseas-pcb-order/v1/shoppingCart/smtGood/"
+	JLC_DELAY     = time.Second // the time between requests once the burst is used
+	JLC_BURST     = 5           // the number of requests that can be made at once
+	JLC_PAGE_SIZE = 25
+	JLC_TIMEOUT   = 30 * time.Second // the timeout of each attempt of a request
+	JLC_RETRIES   = 3                // the number of times a failed request is retried
+	JLC_BACKOFF   = 2 * time.Second  // the wait before the first retry, doubled for each retry after
+	JLC_CACHE_TTL = 24 * time.Hour   // how long search and detail responses are cached
+)
+
+/*
+APIError is returned when JLCPCB responds to a request with an error,
+either as the HTTP status or as the code in the response
+*/
+type APIError struct {
+	Method  string
+	Status  int // the HTTP status
+	Code    int // the code in the response, if it was decoded
+	Message string
+}
+
+func (e *APIError) Error() string {
+	if e.Code != 0 && e.Code != http.StatusOK {
+		return fmt.Sprintf("jlcpcb %s failed with code %d: %s", e.Method, e.Code, e.Message)
+	}
+
+	return fmt.Sprintf("jlcpcb %s failed with status %d: %s", e.Method, e.Status, e.Message)
+}
+
+/*
+return whether the request may succeed if it is made again, which JLCPCB
+may report as the HTTP status or as the code in the response
+*/
+func (e *APIError) Temporary() bool {
+	return e.Status == http.StatusTooManyRequests || e.Status >= 500 ||
+		e.Code == http.StatusTooManyRequests || e.Code >= 500
+}
+
+/*
+ErrNoDetail is returned when JLCPCB has no detail for a part, which is how
+it answers for a part that it does not know
+
+Other errors do not mean that the part does not exist
+*/
+var ErrNoDetail = errors.New("no detail")
+
+/*
+errNoData is returned when a response succeeds without data
+*/
+var errNoData = errors.New("no data")
+
+/*
+ComponentSource looks up JLCPCB parts
+
+JLC is the implementation that uses the JLCPCB website
+*/
+type ComponentSource interface {
+	SelectComponentList(ctx context.Context, keyword string) (map[int64]*LibraryComponent, error)
+	FindComponents(ctx context.Context, query ComponentQuery) (*ComponentPage, error)
+	SelectLibraryPage(ctx context.Context, libraryType string, page int) (*ComponentPage, error)
+	GetComponentDetail(ctx context.Context, cid string) (*LibraryComponent, error)
+	Exact(ctx context.Context, cid string) (*LibraryComponent, error)
+}
+
+var _ ComponentSource = (*JLC)(nil)
+
 type JLC struct {
-	lock *sync.Mutex
+	limiter  *rateLimiter
+	cache    *responseCache // nil if responses are not cached
+	client   *http.Client
+	url      string
+	pageSize int
+	offline  bool // whether only cached responses are used
+	timeout  time.Duration
+	retries  int
+	backoff  time.Duration
 }
 
 type JLCLibraryComponent struct {
-	CID string `json:"componentCode"`
+	CID       string `json:"componentCode"`
+	Preferred bool   `json:"preferredComponentFlag"` // preferred parts are listed as expand
 	LibraryComponent
 }
 
+/*
+return the library component with its ID and three-way library type
+*/
+func (c *JLCLibraryComponent) component() *LibraryComponent {
+	c.ID = FromCID(c.CID)
+	if c.Preferred && c.LibraryType == LIBRARY_EXTENDED {
+		c.LibraryType = LIBRARY_PREFERRED
+	}
+	c.Basic = c.LibraryType == LIBRARY_BASIC
+
+	return &c.LibraryComponent
+}
+
 func NewJLC() *JLC {
-	return &JLC{
-		lock: &sync.Mutex{},
+	return NewConfiguredJLC(JLCConfig{})
+}
+
+/*
+Create a JLC client from the configuration; unset values use the defaults
+*/
+func NewConfiguredJLC(config JLCConfig) *JLC {
+	jlc := &JLC{
+		client:   http.DefaultClient,
+		url:      JLC_URL,
+		pageSize: JLC_PAGE_SIZE,
+		timeout:  JLC_TIMEOUT,
+		retries:  JLC_RETRIES,
+		backoff:  JLC_BACKOFF,
 	}
+
+	if config.URL != "" {
+		jlc.url = config.URL
+	}
+
+	if config.HTTPClient != nil {
+		jlc.client = config.HTTPClient
+	}
+
+	delay, burst := JLC_DELAY, JLC_BURST
+	if config.Delay != nil {
+		delay = *config.Delay
+	}
+
+	if config.Burst > 0 {
+		burst = config.Burst
+	}
+	jlc.limiter = newRateLimiter(delay, burst)
+
+	if config.Cache != "" && config.CacheTTL > 0 {
+		jlc.cache = &responseCache{dir: config.Cache, ttl: config.CacheTTL}
+	}
+
+	if config.PageSize > 0 {
+		jlc.pageSize = config.PageSize
+	}
+
+	if config.Timeout > 0 {
+		jlc.timeout = config.Timeout
+	}
+
+	if config.Retries != nil {
+		jlc.retries = *config.Retries
+	}
+
+	return jlc
 }
 
 type jlcRequest interface {
 	Method() string
+	Cacheable() bool // whether the response may be reused
+	Fresh() bool     // whether a cached response must not be used for this request
 }
 
 type jlcSelectComponentListRequest struct {
 	ComponentAttributes    []string `json:"componentAttributes"`
 	ComponentBrand         string   `json:"componentBrand"`
 	ComponentLibraryType   string   `json:"componentLibraryType"`
+	PreferredComponentFlag bool     `json:"preferredComponentFlag,omitempty"`
 	ComponentSpecification *string  `json:"componentSpecification"`
 	CurrentPage            int      `json:"currentPage"`
 	FirstSortId            string   `json:"firstSortId"`
@@ -43,133 +188,372 @@ type jlcSelectComponentListRequest struct {
 	SecondSortName         string   `json:"secondSortName"`
 	StockFlag              *string  `json:"stockFlag"`
 	StockSort              *string  `json:"stockSort"`
+
+	fresh bool // whether a cached response must not be used
 }
 
 func (r jlcSelectComponentListRequest) Method() string { return "selectSmtComponentList" }
 
+/*
+preferred parts are requested as extended parts with the preferred flag
+*/
+func (r *jlcSelectComponentListRequest) setLibraryType(libraryType string) {
+	if libraryType == LIBRARY_PREFERRED {
+		r.ComponentLibraryType = LIBRARY_EXTENDED
+		r.PreferredComponentFlag = true
+		return
+	}
+
+	r.ComponentLibraryType = libraryType
+}
+
+/*
+searches are cached, but not the basic parts list so that load is always current
+*/
+func (r jlcSelectComponentListRequest) Cacheable() bool { return !r.fresh }
+
+func (r jlcSelectComponentListRequest) Fresh() bool { return r.fresh }
+
+/*
+every response has the same envelope; data is decoded into the response of the request
+*/
+type jlcResponse struct {
+	Code    int             `json:"code"`
+	Message string          `json:"message"`
+	Data    json.RawMessage `json:"data"`
+}
+
 type jlcSelectComponentListResponse struct {
-	Code int `json:"code"`
-	Data struct {
-		ComponentPageInfo struct {
-			EndRow          int                    `json:"endRow"`
-			HasNextPage     bool                   `json:"hasNextPage"`
-			HasPreviousPage bool                   `json:"hasPreviousPage"`
-			IsFirstPage     bool                   `json:"isFirstPage"`
-			IsLastPage      bool                   `json:"isLastPage"`
-			List            []*JLCLibraryComponent `json:"list"`
-		} `json:"componentPageInfo"`
-	} `json:"data"`
-}
-
-func (jlc *JLC) makeRequest(request jlcRequest, response interface{}) error {
-	jlc.lock.Lock()
-	go func() {
-		defer jlc.lock.Unlock()
-		time.Sleep(1500 * time.Millisecond)
-	}()
-
-	rd, wr := io.Pipe()
-
-	go func() {
-		enc := json.NewEncoder(wr)
-		enc.Encode(request)
-		wr.Close()
-	}()
-
-	req, err := http.NewRequest(
-		"POST",
-		"https://jlcpcb.com/api/overseas-pcb-order/v1/shoppingCart/smtGood/"+request.Method(),
-		bufio.NewReader(rd),
-	)
+	ComponentPageInfo struct {
+		EndRow          int                    `json:"endRow"`
+		HasNextPage     bool                   `json:"hasNextPage"`
+		HasPreviousPage bool                   `json:"hasPreviousPage"`
+		IsFirstPage     bool                   `json:"isFirstPage"`
+		IsLastPage      bool                   `json:"isLastPage"`
+		Total           int                    `json:"total"`
+		List            []*JLCLibraryComponent `json:"list"`
+	} `json:"componentPageInfo"`
+}
 
-	req.Header.Add("Content-Type", "application/json")
+type jlcGetComponentDetailRequest struct {
+	ComponentCode string `json:"componentCode"`
+
+	fresh bool // whether to fetch the detail again even if it is cached
+}
+
+func (r jlcGetComponentDetailRequest) Method() string { return "getComponentDetail" }
+
+/*
+details are always cached, and a fresh detail replaces the cached one
+*/
+func (r jlcGetComponentDetailRequest) Cacheable() bool { return true }
+
+func (r jlcGetComponentDetailRequest) Fresh() bool { return r.fresh }
+
+type jlcGetComponentDetailResponse struct {
+	JLCLibraryComponent
+	DetailPrices []LibraryPrice `json:"prices"`
+	SecondTypeEn string         `json:"secondTypeNameEn"`
+}
+
+/*
+make a request and decode the data of the response
+
+Cached responses are used if they have not expired. Otherwise requests are
+limited by the rate limiter of the client, and requests that fail with a
+network error, or with 429 or 5xx as the HTTP status or the code in the
+response, are retried with exponential backoff.
+*/
+func (jlc *JLC) makeRequest(ctx context.Context, request jlcRequest, response interface{}) error {
+	body, err := json.Marshal(request)
 	if err != nil {
 		return err
 	}
 
-	resp, err := http.DefaultClient.Do(req)
-	if err != nil {
-		return err
+	cache := jlc.cache
+	if !request.Cacheable() {
+		cache = nil
 	}
 
-	//	buf, err := ioutil.ReadAll(resp.Body)
-	//	fmt.Println(string(buf))
-	//
-	//	dec := json.NewDecoder(bytes.NewReader(buf))
+	/* stale responses are better than none when offline */
+	if cache != nil && !request.Fresh() {
+		if data, ok := cache.get(request.Method(), body, jlc.offline); ok && json.Unmarshal(data, response) == nil {
+			return nil
+		}
+	}
+
+	if jlc.offline {
+		return fmt.Errorf("jlcpcb %s: %w", request.Method(), ErrOffline)
+	}
+
+	backoff := jlc.backoff
+	for attempt := 0; ; attempt++ {
+		var wait time.Duration
+		data, err := jlc.attempt(ctx, request.Method(), body, &wait)
+		if err == nil {
+			if err := json.Unmarshal(data, response); err != nil {
+				return fmt.Errorf("jlcpcb %s returned an invalid response: %w", request.Method(), err)
+			}
+
+			if cache != nil {
+				cache.put(request.Method(), body, data)
+			}
+
+			return nil
+		}
 
-	dec := json.NewDecoder(resp.Body)
-	return dec.Decode(&response)
+		var apiErr *APIError
+		temporary := isNetworkError(err) || errors.As(err, &apiErr) && apiErr.Temporary()
+		if !temporary || attempt >= jlc.retries || ctx.Err() != nil {
+			return err
+		}
+
+		if wait < backoff {
+			wait = backoff
+		}
+		backoff *= 2
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(wait):
+		}
+	}
 }
 
-func (jlc *JLC) SelectComponentList(keyword string) (map[int64]*LibraryComponent, error) {
-	request := jlcSelectComponentListRequest{
-		CurrentPage:  1,
-		PageSize:     25,
-		SearchSource: "search",
-		Keyword:      &keyword,
+/*
+make one attempt at a request and return the data of the response
+
+wait is set from Retry-After if JLCPCB asks to slow down
+*/
+func (jlc *JLC) attempt(ctx context.Context, method string, body []byte, wait *time.Duration) (json.RawMessage, error) {
+	if err := jlc.limiter.Wait(ctx); err != nil {
+		return nil, err
 	}
 
-	response := jlcSelectComponentListResponse{}
-	jlc.makeRequest(request, &response)
+	ctx, cancel := context.WithTimeout(ctx, jlc.timeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, "POST", jlc.url+method, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Add("Content-Type", "application/json")
+
+	resp, err := jlc.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		if seconds, err := strconv.Atoi(resp.Header.Get("Retry-After")); err == nil {
+			*wait = time.Duration(seconds) * time.Second
+		}
+
+		message, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return nil, &APIError{Method: method, Status: resp.StatusCode, Message: strings.TrimSpace(string(message))}
+	}
+
+	envelope := jlcResponse{}
+	if err := json.NewDecoder(resp.Body).Decode(&envelope); err != nil {
+		return nil, fmt.Errorf("jlcpcb %s returned an invalid response: %w", method, err)
+	}
+
+	if envelope.Code != http.StatusOK {
+		return nil, &APIError{Method: method, Status: resp.StatusCode, Code: envelope.Code, Message: envelope.Message}
+	}
+
+	if len(envelope.Data) == 0 || string(envelope.Data) == "null" {
+		return nil, fmt.Errorf("jlcpcb %s: %w", method, errNoData)
+	}
+
+	return envelope.Data, nil
+}
+
+/*
+return whether the error is a failure to reach JLCPCB, including a timeout
+*/
+func isNetworkError(err error) bool {
+	var urlErr *url.Error
+	return errors.As(err, &urlErr) && !errors.Is(err, context.Canceled)
+}
+
+func (jlc *JLC) SelectComponentList(ctx context.Context, keyword string) (map[int64]*LibraryComponent, error) {
+	page, err := jlc.FindComponents(ctx, ComponentQuery{Keyword: keyword})
+	if err != nil {
+		return nil, err
+	}
 
 	components := make(map[int64]*LibraryComponent)
-	for _, component := range response.Data.ComponentPageInfo.List {
-		component.ID = FromCID(component.CID)
-		components[component.ID] = &component.LibraryComponent
+	for _, component := range page.Components {
+		components[component.ID] = component
 	}
 
 	return components, nil
 }
 
-func (jlc *JLC) Exact(cid string) *LibraryComponent {
-	components, err := jlc.SelectComponentList(cid)
-	if err != nil {
-		return &LibraryComponent{ID: FromCID(cid), Description: "No description available"}
+/*
+Find one page of the parts that match the query
+*/
+func (jlc *JLC) FindComponents(ctx context.Context, query ComponentQuery) (*ComponentPage, error) {
+	request := jlcSelectComponentListRequest{
+		ComponentAttributes: query.Attributes,
+		ComponentBrand:      query.Brand,
+		CurrentPage:         max(query.Page, 1),
+		FirstSortName:       query.Category,
+		PageSize:            jlc.pageSize,
+		SearchSource:        "search",
+		SecondSortName:      query.Subcategory,
 	}
+	request.setLibraryType(query.LibraryType)
 
-	component, ok := components[FromCID(cid)]
-	if !ok {
-		return &LibraryComponent{ID: FromCID(cid), Description: "No description available"}
+	if query.PageSize > 0 {
+		request.PageSize = query.PageSize
+	}
+
+	if query.Keyword != "" {
+		request.Keyword = &query.Keyword
+	}
+
+	if query.Package != "" {
+		request.ComponentSpecification = &query.Package
+	}
+
+	if query.InStock {
+		flag := "true"
+		request.StockFlag = &flag
+	}
+
+	response := jlcSelectComponentListResponse{}
+	if err := jlc.makeRequest(ctx, request, &response); err != nil {
+		return nil, err
 	}
 
-	return component
+	page := &ComponentPage{
+		Page:    request.CurrentPage,
+		HasNext: response.ComponentPageInfo.HasNextPage,
+		Total:   response.ComponentPageInfo.Total,
+	}
+	for _, component := range response.ComponentPageInfo.List {
+		if lc := component.component(); query.matches(lc) {
+			page.Components = append(page.Components, lc)
+		}
+	}
+
+	return page, nil
 }
 
-func (jlc *JLC) SelectBaseComponentList() (<-chan *LibraryComponent, <-chan error) {
-	size := 100
-	components := make(chan *LibraryComponent, size)
-	errs := make(chan error)
+/*
+Get everything that JLCPCB knows about a part, including its attributes,
+datasheet and price tiers
+*/
+func (jlc *JLC) GetComponentDetail(ctx context.Context, cid string) (*LibraryComponent, error) {
+	return jlc.getComponentDetail(ctx, jlcGetComponentDetailRequest{ComponentCode: cid})
+}
 
-	go func() {
-		defer close(components)
-		defer close(errs)
+/*
+Get the current detail of a part from JLCPCB, bypassing the cache, e.g. to
+refresh its stock and prices
+*/
+func (jlc *JLC) RefreshComponentDetail(ctx context.Context, cid string) (*LibraryComponent, error) {
+	return jlc.getComponentDetail(ctx, jlcGetComponentDetailRequest{ComponentCode: cid, fresh: true})
+}
 
-		page := 1
-		for {
-			request := jlcSelectComponentListRequest{
-				ComponentLibraryType: "base",
-				CurrentPage:          page,
-				PageSize:             size,
-				SearchSource:         "search",
-			}
+func (jlc *JLC) getComponentDetail(ctx context.Context, request jlcGetComponentDetailRequest) (*LibraryComponent, error) {
+	response := jlcGetComponentDetailResponse{}
+	if err := jlc.makeRequest(ctx, request, &response); errors.Is(err, errNoData) {
+		return nil, fmt.Errorf("%w for %s", ErrNoDetail, request.ComponentCode)
+	} else if err != nil {
+		return nil, err
+	}
 
-			response := jlcSelectComponentListResponse{}
-			jlc.makeRequest(request, &response)
+	if response.CID == "" {
+		return nil, fmt.Errorf("%w for %s", ErrNoDetail, request.ComponentCode)
+	}
 
-			if len(response.Data.ComponentPageInfo.List) == 0 {
-				return
-			}
+	component := response.component()
+	if len(response.DetailPrices) > 0 {
+		component.Prices = response.DetailPrices
+	}
 
-			for _, component := range response.Data.ComponentPageInfo.List {
-				component.ID = FromCID(component.CID)
-				component.Basic = true
+	if component.Category == "" {
+		component.Category = response.SecondTypeEn
+	}
 
-				components <- &component.LibraryComponent
-			}
+	return component, nil
+}
+
+/*
+return the part with the given CID, or an error if it cannot be found
 
-			page++
+a part that could not be looked up must not be associated, because its
+record would have no package, price or stock
+*/
+func (jlc *JLC) Exact(ctx context.Context, cid string) (*LibraryComponent, error) {
+	return jlc.GetComponentDetail(ctx, cid)
+}
+
+/*
+List one page of the basic or preferred parts, never from the cache
+*/
+func (jlc *JLC) SelectLibraryPage(ctx context.Context, libraryType string, page int) (*ComponentPage, error) {
+	request := jlcSelectComponentListRequest{
+		CurrentPage:  max(page, 1),
+		PageSize:     BASIC_PAGE_SIZE,
+		SearchSource: "search",
+		fresh:        true,
+	}
+	request.setLibraryType(libraryType)
+
+	response := jlcSelectComponentListResponse{}
+	if err := jlc.makeRequest(ctx, request, &response); err != nil {
+		return nil, fmt.Errorf("page %d: %w", request.CurrentPage, err)
+	}
+
+	result := &ComponentPage{
+		Page:    request.CurrentPage,
+		HasNext: response.ComponentPageInfo.HasNextPage,
+		Total:   response.ComponentPageInfo.Total,
+	}
+	for _, component := range response.ComponentPageInfo.List {
+		lc := component.component()
+		if lc.LibraryType == "" {
+			lc.SetType(libraryType)
 		}
-	}()
 
-	return components, errs
+		result.Components = append(result.Components, lc)
+	}
+
+	/* the end of the list is an empty page if JLCPCB does not say otherwise */
+	if len(result.Components) == 0 {
+		result.HasNext = false
+	}
+
+	return result, nil
+}
+
+/*
+return the component for a part entered at the prompt
+
+An empty input skips the component, consigned: and global: references are
+sourced outside of JLCPCB, and other parts are taken from the search
+results or else looked up in the source, which fails if the part cannot
+be found
+*/
+func SelectComponent(ctx context.Context, source ComponentSource, results map[int64]*LibraryComponent, input string) (*LibraryComponent, error) {
+	input = strings.TrimSpace(input)
+	if input == "" {
+		return &LibraryComponent{}, nil
+	}
+
+	if lc := ParseSourced(input); lc != nil {
+		return lc, nil
+	}
+
+	if result, ok := results[FromCID(input)]; ok {
+		return result, nil
+	}
+
+	return source.Exact(ctx, input)
 }
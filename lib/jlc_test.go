@@ -1,62 +1,324 @@
 package lib
 
 import (
-	"fmt"
+	"context"
+	"errors"
+	"net/http"
 	"testing"
+	"time"
+
+	"github.com/xoviat/jcad/lib/jlctest"
 )
 
-func TestSelectBaseComponentList(t *testing.T) {
-	jlc := NewJLC()
-
-	/*
-		componentAttributes	:  []
-		componentBrand	: 	null
-		componentLibraryType	: 	"base"
-		componentSpecification	: 	null
-		currentPage	: 	2
-		firstSortId	: 	""
-		firstSortName	: 	""
-		firstSortNameNew	: 	""
-		keyword	: 	null
-		pageSize	: 	25
-		searchSource	: 	"search"
-		secondSortName	: 	""
-		stockFlag	: 	null
-		stockSort	: 	null
-	*/
-
-	// categories := make(map[string]struct{})
-	components, err := jlc.SelectBaseComponentList()
-	//	for component := range components {
-	//		categories[component.Category] = struct{}{}
-	//	}
-	//
-	//	for category := range categories {
-	//		fmt.Println(category)
-	//	}
-
-	//	for component := range components {
-	//		_ = component
-	//	}
-
-	//	for component := range components {
-	//		key := component.BasicKey()
-	//		name := component.CID()
-	//		category := component.Description
-	//		pkg := component.Package
-	//
-	//		fmt.Printf("%s : %s : %s : %s\n", name, category, pkg, key)
-	//	}
-
-	_, _ = components, err
+/*
+return a JLC client for the recorded responses in test-data
+*/
+func newTestJLC(t *testing.T) (*JLC, *jlctest.Server) {
+	s, err := jlctest.NewServer("../test-data")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(s.Close)
+
+	delay := time.Duration(0)
+	jlc := NewConfiguredJLC(JLCConfig{URL: s.BaseURL(), HTTPClient: s.Client(), Delay: &delay, PageSize: 10})
+	jlc.backoff = time.Millisecond
+
+	return jlc, s
 }
+
+func TestSelectLibraryPage(t *testing.T) {
+	jlc, s := newTestJLC(t)
+
+	page, err := jlc.SelectLibraryPage(context.Background(), LIBRARY_BASIC, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	lcs := page.Components
+	if len(lcs) != 25 || page.HasNext {
+		t.Fatalf("expected 25 basic parts, got %d", len(lcs))
+	}
+
+	for _, lc := range lcs {
+		if !lc.Basic || lc.ID == 0 {
+			t.Errorf("unexpected part: %+v", lc)
+		}
+	}
+
+	if n := s.Requests("selectSmtComponentList"); n < 1 {
+		t.Errorf("expected the list to be requested")
+	}
+
+	/* the load command imports the basic parts into the library */
+	library, err := OpenLibrary(t.TempDir(), false, LibraryOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer library.Close()
+
+	if _, err := library.ImportParts(lcs); err != nil {
+		t.Fatal(err)
+	}
+
+	results := library.Search(SearchQuery{Text: []string{"ZMM3V3"}})
+	if len(results) != 1 || results[0].Component.CID() != "C8056" {
+		t.Errorf("expected C8056 to be found after loading, got %v", results)
+	}
+}
+
 func TestSelectComponentList(t *testing.T) {
-	jlc := NewJLC()
+	jlc, _ := newTestJLC(t)
+
+	components, err := jlc.SelectComponentList(context.Background(), "ZMM3V3")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	component, ok := components[8056]
+	if !ok || component.Part != "ZMM3V3-M" || component.Package != "LL-34" {
+		t.Errorf("expected C8056, got %v", components)
+	}
+
+	if lc, err := jlc.Exact(context.Background(), "C11616"); err != nil || lc.CID() != "C11616" || lc.Package != "0402" {
+		t.Errorf("unexpected exact match: %+v %v", lc, err)
+	}
+}
+
+func TestGetComponentDetail(t *testing.T) {
+	jlc, _ := newTestJLC(t)
+
+	lc, err := jlc.GetComponentDetail(context.Background(), "C1547")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if lc.ID != 1547 || lc.Part != "0402CG120J500NT" || lc.Package != "0402" {
+		t.Errorf("unexpected part: %+v", lc)
+	}
+
+	if capacitance := lc.Attribute("capacitance"); capacitance != "12pF" {
+		t.Errorf("unexpected capacitance: %q", capacitance)
+	}
+
+	if lc.Datasheet == "" || lc.Image == "" || lc.Stock != 426495 || lc.MinimumOrder != 1 || lc.LibraryType != "base" {
+		t.Errorf("missing detail: %+v", lc)
+	}
+
+	if len(lc.Prices) == 0 || lc.UnitPrice(1) != 0.001 {
+		t.Errorf("unexpected prices: %+v", lc.Prices)
+	}
+
+	if lc.Category != "Multilayer Ceramic Capacitors MLCC - SMD/SMT" {
+		t.Errorf("unexpected category: %s", lc.Category)
+	}
+
+	if _, err := jlc.GetComponentDetail(context.Background(), "C99999999"); err == nil {
+		t.Errorf("expected an error for an unknown part")
+	}
+
+	/* the detail is kept in the library */
+	library, err := OpenLibrary(t.TempDir(), false, LibraryOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer library.Close()
+
+	if err := library.Store(lc); err != nil {
+		t.Fatal(err)
+	}
+
+	if stored := library.Exact("C1547"); stored.Attribute("Capacitance") != "12pF" || stored.Datasheet != lc.Datasheet {
+		t.Errorf("detail was not kept: %+v", stored)
+	}
+}
+
+func TestSelectComponent(t *testing.T) {
+	jlc, s := newTestJLC(t)
+
+	results, err := jlc.SelectComponentList(context.Background(), "0805")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	requests := s.Requests("getComponentDetail")
+	for input, reference := range map[string]string{
+		"":                 "C0",
+		"consigned:LM7805": "consigned:LM7805",
+		"C17408":           "C17408",
+		" C8056 ":          "C8056",
+	} {
+		if lc, err := SelectComponent(context.Background(), jlc, results, input); err != nil || lc.Reference() != reference {
+			t.Errorf("%q: expected %s, got %s %v", input, reference, lc.Reference(), err)
+		}
+	}
+
+	/* only the part that was not in the results is looked up */
+	if n := s.Requests("getComponentDetail") - requests; n != 1 {
+		t.Errorf("expected one lookup, got %d", n)
+	}
 
-	components, err := jlc.SelectComponentList("6TPE330MAP")
-	for _, component := range components {
-		fmt.Println(component.Description)
+	/* a part that cannot be looked up is not selected */
+	for _, status := range []int{0, http.StatusServiceUnavailable} {
+		if status != 0 {
+			s.Fail("getComponentDetail", status, status, status, status)
+		}
+
+		if lc, err := SelectComponent(context.Background(), jlc, results, "C99999999"); err == nil || lc != nil {
+			t.Errorf("expected the lookup to fail, got %+v", lc)
+		}
+	}
+}
+
+func TestMakeRequestErrors(t *testing.T) {
+	jlc, s := newTestJLC(t)
+	ctx := context.Background()
+
+	/* temporary failures are retried */
+	s.Fail("selectSmtComponentList", http.StatusServiceUnavailable, http.StatusTooManyRequests)
+	components, err := jlc.SelectComponentList(ctx, "ZMM3V3")
+	if err != nil || len(components) != 1 {
+		t.Errorf("expected the request to be retried, got %v %v", components, err)
+	}
+
+	if n := s.Requests("selectSmtComponentList"); n != 3 {
+		t.Errorf("expected 3 attempts, got %d", n)
 	}
 
-	_, _ = components, err
+	/* until the retries run out */
+	s.Fail("selectSmtComponentList", http.StatusBadGateway, http.StatusBadGateway, http.StatusBadGateway, http.StatusBadGateway)
+	_, err = jlc.SelectComponentList(ctx, "ZMM3V3")
+
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) || apiErr.Status != http.StatusBadGateway {
+		t.Errorf("expected a bad gateway error, got %v", err)
+	}
+
+	/* so are temporary failures reported in the response */
+	requests := s.Requests("selectSmtComponentList")
+	s.FailCode("selectSmtComponentList", http.StatusInternalServerError, http.StatusTooManyRequests)
+	if components, err := jlc.SelectComponentList(ctx, "ZMM3V3"); err != nil || len(components) != 1 {
+		t.Errorf("expected the request to be retried, got %v %v", components, err)
+	}
+
+	if n := s.Requests("selectSmtComponentList") - requests; n != 3 {
+		t.Errorf("expected 3 attempts, got %d", n)
+	}
+
+	/* other error codes in the response are not retried */
+	requests = s.Requests("selectSmtComponentList")
+	s.FailCode("selectSmtComponentList", http.StatusBadRequest)
+	_, err = jlc.SelectComponentList(ctx, "ZMM3V3")
+	if !errors.As(err, &apiErr) || apiErr.Code != http.StatusBadRequest || apiErr.Temporary() {
+		t.Errorf("expected an error code, got %v", err)
+	}
+
+	if n := s.Requests("selectSmtComponentList") - requests; n != 1 {
+		t.Errorf("expected one attempt, got %d", n)
+	}
+
+	/* an unknown part has no detail, and is not retried */
+	requests = s.Requests("getComponentDetail")
+	if _, err := jlc.GetComponentDetail(ctx, "C99999999"); !errors.Is(err, ErrNoDetail) {
+		t.Errorf("expected no detail, got %v", err)
+	}
+
+	if n := s.Requests("getComponentDetail") - requests; n != 1 {
+		t.Errorf("expected one attempt, got %d", n)
+	}
+
+	/* the basic parts list reports the failure */
+	s.Fail("selectSmtComponentList", http.StatusNotFound)
+	if _, err := jlc.SelectLibraryPage(ctx, LIBRARY_BASIC, 1); !errors.As(err, &apiErr) || apiErr.Status != http.StatusNotFound {
+		t.Errorf("expected the list to fail, got %v", err)
+	}
+
+	/* a cancelled request is not retried */
+	cancelled, cancel := context.WithCancel(ctx)
+	cancel()
+
+	requests = s.Requests("getComponentDetail")
+	if _, err := jlc.GetComponentDetail(cancelled, "C1547"); !errors.Is(err, context.Canceled) {
+		t.Errorf("expected the request to be cancelled, got %v", err)
+	}
+
+	if n := s.Requests("getComponentDetail") - requests; n != 0 {
+		t.Errorf("expected no requests, got %d", n)
+	}
+}
+
+func TestResponseCache(t *testing.T) {
+	s, err := jlctest.NewServer("../test-data")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	delay := time.Duration(0)
+	config := JLCConfig{
+		URL: s.BaseURL(), HTTPClient: s.Client(), Delay: &delay, Cache: t.TempDir(), CacheTTL: time.Hour,
+	}
+
+	ctx := context.Background()
+	for i := 0; i < 2; i++ {
+		/* a new client shares the cache on disk */
+		jlc := NewConfiguredJLC(config)
+
+		if components, err := jlc.SelectComponentList(ctx, "ZMM3V3"); err != nil || len(components) != 1 {
+			t.Errorf("unexpected search results: %v %v", components, err)
+		}
+
+		if lc, err := jlc.GetComponentDetail(ctx, "C1547"); err != nil || lc.Attribute("Capacitance") != "12pF" {
+			t.Errorf("unexpected detail: %+v %v", lc, err)
+		}
+
+		if page, err := jlc.SelectLibraryPage(ctx, LIBRARY_BASIC, 1); err != nil || len(page.Components) != 25 {
+			t.Errorf("unexpected basic parts: %v %v", page, err)
+		}
+	}
+
+	if n := s.Requests("getComponentDetail"); n != 1 {
+		t.Errorf("expected the detail to be cached, got %d requests", n)
+	}
+
+	/* one search and a page of basic parts on each run */
+	if n := s.Requests("selectSmtComponentList"); n != 3 {
+		t.Errorf("expected only the search to be cached, got %d requests", n)
+	}
+
+	/* expired responses are requested again */
+	config.CacheTTL = time.Nanosecond
+	if _, err := NewConfiguredJLC(config).GetComponentDetail(ctx, "C1547"); err != nil {
+		t.Fatal(err)
+	}
+
+	if n := s.Requests("getComponentDetail"); n != 2 {
+		t.Errorf("expected the expired detail to be requested, got %d requests", n)
+	}
+}
+
+func TestRateLimiter(t *testing.T) {
+	limiter := newRateLimiter(50*time.Millisecond, 3)
+	ctx := context.Background()
+
+	start := time.Now()
+	for i := 0; i < 3; i++ {
+		limiter.Wait(ctx)
+	}
+
+	if elapsed := time.Since(start); elapsed > 25*time.Millisecond {
+		t.Errorf("expected the burst to be immediate, took %s", elapsed)
+	}
+
+	limiter.Wait(ctx)
+	if elapsed := time.Since(start); elapsed < 40*time.Millisecond {
+		t.Errorf("expected to wait after the burst, took %s", elapsed)
+	}
+
+	cancelled, cancel := context.WithCancel(ctx)
+	cancel()
+
+	if err := limiter.Wait(cancelled); !errors.Is(err, context.Canceled) {
+		t.Errorf("expected the wait to be cancelled, got %v", err)
+	}
 }
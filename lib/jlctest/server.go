@@ -0,0 +1,372 @@
+/*
+Package jlctest provides a fake JLCPCB component API for tests
+
+The fake serves the recorded responses in the test-data directory so that
+the JLC client and the commands that use it can be tested offline.
+*/
+package jlctest
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+const (
+	LIST_FILE   = "jlcSelectSmtComponentList.json"
+	DETAIL_FILE = "jlcGetComponentDetail.json"
+)
+
+/*
+A recorded component, with the fields that the fake filters on
+*/
+type component struct {
+	raw           json.RawMessage
+	code          string
+	model         string
+	describe      string
+	libraryType   string
+	preferred     bool
+	specification string
+	brand         string
+	typeName      string
+	stock         int64
+}
+
+/*
+Server is a fake JLCPCB component API
+
+The detail of a part without a recorded detail response is its entry in
+the recorded list. Like JLCPCB, the detail of an unknown part is a
+response without data.
+
+Use BaseURL() as the base URL of the JLC client and Client() as its HTTP client
+*/
+type Server struct {
+	*httptest.Server
+
+	components []component
+	details    map[string]json.RawMessage
+
+	lock     sync.Mutex
+	requests map[string]int
+	failures map[string][]failure
+}
+
+/*
+a failure of the next request, either as the HTTP status or as the code in
+the response
+*/
+type failure struct {
+	status int
+	code   int
+}
+
+/*
+Start a fake JLCPCB API that serves the recorded responses in dir
+*/
+func NewServer(dir string) (*Server, error) {
+	s := &Server{
+		details:  make(map[string]json.RawMessage),
+		requests: make(map[string]int),
+		failures: make(map[string][]failure),
+	}
+
+	if err := s.loadList(filepath.Join(dir, LIST_FILE)); err != nil {
+		return nil, err
+	}
+
+	if err := s.loadDetail(filepath.Join(dir, DETAIL_FILE)); err != nil {
+		return nil, err
+	}
+
+	s.Server = httptest.NewServer(http.HandlerFunc(s.handle))
+	return s, nil
+}
+
+func (s *Server) loadList(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	response := struct {
+		Data struct {
+			ComponentPageInfo struct {
+				List []json.RawMessage `json:"list"`
+			} `json:"componentPageInfo"`
+		} `json:"data"`
+	}{}
+	if err := json.Unmarshal(data, &response); err != nil {
+		return err
+	}
+
+	for _, raw := range response.Data.ComponentPageInfo.List {
+		if err := s.add(raw); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+/*
+Add a part to the list, as it would be returned by JLCPCB
+
+Parts should be added before the server is used
+*/
+func (s *Server) Add(raw json.RawMessage) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	return s.add(raw)
+}
+
+func (s *Server) add(raw json.RawMessage) error {
+	fields := struct {
+		Code          string `json:"componentCode"`
+		Model         string `json:"componentModelEn"`
+		Describe      string `json:"describe"`
+		LibraryType   string `json:"componentLibraryType"`
+		Preferred     bool   `json:"preferredComponentFlag"`
+		Specification string `json:"componentSpecificationEn"`
+		Brand         string `json:"componentBrandEn"`
+		TypeName      string `json:"componentTypeEn"`
+		Stock         int64  `json:"stockCount"`
+	}{}
+	if err := json.Unmarshal(raw, &fields); err != nil {
+		return err
+	}
+
+	s.components = append(s.components, component{
+		raw:           raw,
+		code:          fields.Code,
+		model:         fields.Model,
+		describe:      fields.Describe,
+		libraryType:   fields.LibraryType,
+		preferred:     fields.Preferred,
+		specification: fields.Specification,
+		brand:         fields.Brand,
+		typeName:      fields.TypeName,
+		stock:         fields.Stock,
+	})
+
+	return nil
+}
+
+func (s *Server) loadDetail(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	response := struct {
+		Data json.RawMessage `json:"data"`
+	}{}
+	if err := json.Unmarshal(data, &response); err != nil {
+		return err
+	}
+
+	code := struct {
+		Code string `json:"componentCode"`
+	}{}
+	if err := json.Unmarshal(response.Data, &code); err != nil {
+		return err
+	}
+
+	s.details[code.Code] = response.Data
+	return nil
+}
+
+/*
+BaseURL returns the base URL to configure the JLC client with
+*/
+func (s *Server) BaseURL() string {
+	return s.Server.URL + "/"
+}
+
+/*
+Requests returns the number of requests made for an API method
+*/
+func (s *Server) Requests(method string) int {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	return s.requests[method]
+}
+
+/*
+Fail the next requests for an API method with the given HTTP statuses, in order
+*/
+func (s *Server) Fail(method string, statuses ...int) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	for _, status := range statuses {
+		s.failures[method] = append(s.failures[method], failure{status: status})
+	}
+}
+
+/*
+Fail the next requests for an API method with the given codes in the
+response, in order, while the HTTP status is 200
+*/
+func (s *Server) FailCode(method string, codes ...int) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	for _, code := range codes {
+		s.failures[method] = append(s.failures[method], failure{code: code})
+	}
+}
+
+func (s *Server) handle(w http.ResponseWriter, r *http.Request) {
+	method := strings.TrimPrefix(r.URL.Path, "/")
+
+	s.lock.Lock()
+	s.requests[method]++
+	fail := failure{}
+	if failures := s.failures[method]; len(failures) > 0 {
+		fail, s.failures[method] = failures[0], failures[1:]
+	}
+	s.lock.Unlock()
+
+	if fail.status != 0 {
+		http.Error(w, http.StatusText(fail.status), fail.status)
+		return
+	}
+
+	if fail.code != 0 {
+		writeJSON(w, map[string]interface{}{"code": fail.code, "message": http.StatusText(fail.code), "data": nil})
+		return
+	}
+
+	switch method {
+	case "selectSmtComponentList":
+		s.selectComponentList(w, r)
+	case "getComponentDetail":
+		s.getComponentDetail(w, r)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func (s *Server) selectComponentList(w http.ResponseWriter, r *http.Request) {
+	request := struct {
+		Keyword                *string `json:"keyword"`
+		ComponentLibraryType   string  `json:"componentLibraryType"`
+		PreferredComponentFlag bool    `json:"preferredComponentFlag"`
+		ComponentSpecification *string `json:"componentSpecification"`
+		ComponentBrand         string  `json:"componentBrand"`
+		SecondSortName         string  `json:"secondSortName"`
+		StockFlag              *string `json:"stockFlag"`
+		CurrentPage            int     `json:"currentPage"`
+		PageSize               int     `json:"pageSize"`
+	}{}
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		writeJSON(w, map[string]interface{}{"code": 400, "message": err.Error()})
+		return
+	}
+
+	matches := []json.RawMessage{}
+	for _, c := range s.components {
+		if request.ComponentLibraryType != "" && c.libraryType != request.ComponentLibraryType {
+			continue
+		}
+
+		if request.PreferredComponentFlag && !c.preferred {
+			continue
+		}
+
+		if request.Keyword != nil && !matchesKeyword(c, *request.Keyword) {
+			continue
+		}
+
+		if request.ComponentSpecification != nil && !strings.EqualFold(c.specification, *request.ComponentSpecification) {
+			continue
+		}
+
+		if request.ComponentBrand != "" && !strings.Contains(strings.ToLower(c.brand), strings.ToLower(request.ComponentBrand)) {
+			continue
+		}
+
+		if request.SecondSortName != "" && !strings.EqualFold(c.typeName, request.SecondSortName) {
+			continue
+		}
+
+		if request.StockFlag != nil && c.stock <= 0 {
+			continue
+		}
+
+		matches = append(matches, c.raw)
+	}
+
+	page, size := request.CurrentPage, request.PageSize
+	if page < 1 {
+		page = 1
+	}
+
+	if size < 1 {
+		size = len(matches)
+	}
+
+	start, end := min((page-1)*size, len(matches)), min(page*size, len(matches))
+
+	writeJSON(w, map[string]interface{}{
+		"code": 200,
+		"data": map[string]interface{}{
+			"componentPageInfo": map[string]interface{}{
+				"hasNextPage": end < len(matches),
+				"isFirstPage": page == 1,
+				"isLastPage":  end >= len(matches),
+				"total":       len(matches),
+				"list":        matches[start:end],
+			},
+		},
+	})
+}
+
+func (s *Server) getComponentDetail(w http.ResponseWriter, r *http.Request) {
+	code := r.URL.Query().Get("componentCode")
+	if code == "" {
+		request := struct {
+			Code string `json:"componentCode"`
+		}{}
+		json.NewDecoder(r.Body).Decode(&request)
+		code = request.Code
+	}
+
+	detail, ok := s.details[code]
+	for _, c := range s.components {
+		if !ok && c.code == code {
+			detail, ok = c.raw, true
+		}
+	}
+
+	if !ok {
+		writeJSON(w, map[string]interface{}{"code": 200, "message": "component not found: " + code, "data": nil})
+		return
+	}
+
+	writeJSON(w, map[string]interface{}{"code": 200, "data": detail})
+}
+
+func matchesKeyword(c component, keyword string) bool {
+	keyword = strings.ToLower(keyword)
+	for _, field := range []string{c.code, c.model, c.describe} {
+		if strings.Contains(strings.ToLower(field), keyword) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(v)
+}
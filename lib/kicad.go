@@ -37,6 +37,13 @@ func NewKicadInterface() (*KiCadInterface, error) {
 		GetProgramFiles(), "KiCad", latestVersion, "bin",
 	)
 
+	return NewKicadInterfaceAt(binPath)
+}
+
+/*
+Use the KiCad installation whose bin path is given instead of the latest version
+*/
+func NewKicadInterfaceAt(binPath string) (*KiCadInterface, error) {
 	if _, err := os.Stat(filepath.Join(binPath, "kicad-cli.exe")); err != nil {
 		return nil, errors.New("KiCad binPath does not exist or does not have kicad-cli")
 	}
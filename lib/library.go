@@ -1,10 +1,12 @@
 package lib
 
 import (
+	"errors"
 	"fmt"
-	"os"
 	"path/filepath"
 	"regexp"
+	"strings"
+	"time"
 
 	"github.com/boltdb/bolt"
 )
@@ -15,6 +17,21 @@ var (
 	PACKAGE_ASC_BKT    = []byte("package-associations")   // Associates a KiCad package with a JLCPCB package
 )
 
+const (
+	SOURCING_CONSIGNED = "consigned" // parts sent to JLCPCB by the customer
+	SOURCING_GLOBAL    = "global"    // parts bought through JLCPCB global sourcing
+)
+
+/*
+the library types of JLCPCB parts; only extended parts have a loading fee
+in economic assembly
+*/
+const (
+	LIBRARY_BASIC     = "base"
+	LIBRARY_PREFERRED = "preferred"
+	LIBRARY_EXTENDED  = "expand"
+)
+
 var (
 	re1 *regexp.Regexp = regexp.MustCompile("[^a-zA-Z]+")
 	re2 *regexp.Regexp = regexp.MustCompile(`[0-9\.]+(pF|nF|uF|mF)`)
@@ -52,124 +69,131 @@ type Library struct {
 	root       string
 	db         *bolt.DB
 	connectors bool
+	excluded   []string
+	session    session
 }
 
 /*
-Import all of the basic parts into the library
+the default time to wait for another process to release the library
 */
-func (l *Library) ImportBasic(components <-chan *LibraryComponent, errs <-chan error) error {
-	l.db.Update(func(tx *bolt.Tx) error {
-		tx.DeleteBucket(COMPONENTS_BKT)
-		tx.CreateBucket(COMPONENTS_BKT)
+const LOCK_TIMEOUT = 5 * time.Second
 
-		return nil
-	})
+var ErrLibraryLocked = errors.New("library is in use by another jcad process")
 
-	return l.db.Update(func(tx *bolt.Tx) error {
-		bcomponents := tx.Bucket(COMPONENTS_BKT)
-		bassociations := tx.Bucket(COMPONENTS_ASC_BKT)
+/*
+Options for opening a library
+*/
+type LibraryOptions struct {
+	ReadOnly bool          // share the library with other readers; writes fail
+	Timeout  time.Duration // how long to wait for the library, or LOCK_TIMEOUT if zero
+}
 
-		for component := range components {
-			bytes, err := Marshal(component)
-			if err != nil {
-				return err
-			}
+/*
+Create or open library from root
+*/
+func NewLibrary(root string, connectors bool) (*Library, error) {
+	return OpenLibrary(root, connectors, LibraryOptions{})
+}
 
-			if key := component.BasicKey(); key != "" {
-				err = bassociations.Put([]byte(key), []byte(component.CID()))
-			}
-			if err != nil {
-				return err
-			}
+/*
+Open the library from root
 
-			err = bcomponents.Put([]byte(component.CID()), bytes)
-			if err != nil {
-				return err
-			}
-		}
+A library opened for writing excludes all other processes, while any
+number of processes may open the library read-only at the same time.
+If the library is in use, ErrLibraryLocked is returned after the timeout.
+*/
+func OpenLibrary(root string, connectors bool, options LibraryOptions) (*Library, error) {
+	if options.Timeout <= 0 {
+		options.Timeout = LOCK_TIMEOUT
+	}
 
-		select {
-		case err := <-errs:
-			return err
-		default:
+	path := filepath.Join(root, "jcad.db")
+	if options.ReadOnly && !Exists(path) {
+		/* a read-only library cannot be created, so create it first */
+		if err := upgradeLibrary(root, connectors, options.Timeout); err != nil {
+			return nil, err
 		}
+	}
 
-		return nil
-	})
-}
-
-/*
-export assocations to an excel file
-*/
-func (l *Library) ExportAssociations() <-chan []string {
-	rows := make(chan []string, 100)
-	go func() {
-		defer close(rows)
-		l.db.View(func(tx *bolt.Tx) error {
-			bassociations := tx.Bucket(COMPONENTS_ASC_BKT)
-			cur := bassociations.Cursor()
-
-			for key, val := cur.First(); key != nil; key, val = cur.Next() {
-				rows <- []string{string(key), string(val)}
-			}
+	db, err := bolt.Open(path, 0666, &bolt.Options{Timeout: options.Timeout, ReadOnly: options.ReadOnly})
+	if err == bolt.ErrTimeout {
+		return nil, fmt.Errorf("%w: %s; close the other process and try again", ErrLibraryLocked, path)
+	} else if err != nil {
+		return nil, err
+	}
 
+	if options.ReadOnly {
+		current := false
+		db.View(func(tx *bolt.Tx) error {
+			version, err := schemaVersion(tx)
+			current = err == nil && version == SCHEMA_VERSION
 			return nil
 		})
-	}()
-
-	return rows
-}
 
-/*
-import assocations from an excel file
-*/
-func (l *Library) ImportAssocations(rows <-chan []string) error {
-	// Skip processing footprint assocations for now
+		if !current {
+			/* a read-only library cannot be migrated, so migrate it first */
+			db.Close()
+			if err := upgradeLibrary(root, connectors, options.Timeout); err != nil {
+				return nil, err
+			}
 
-	return l.db.Update(func(tx *bolt.Tx) error {
-		tx.DeleteBucket(COMPONENTS_ASC_BKT)
-		bassociations, err := tx.CreateBucket(COMPONENTS_ASC_BKT)
-		if err != nil {
-			return err
+			return OpenLibrary(root, connectors, options)
 		}
+	} else {
+		db.Update(func(tx *bolt.Tx) error {
+			tx.CreateBucketIfNotExists(COMPONENTS_BKT)
+			tx.CreateBucketIfNotExists(COMPONENTS_ASC_BKT)
+			tx.CreateBucketIfNotExists(PACKAGE_ASC_BKT)
+			tx.CreateBucketIfNotExists(SEARCH_IDX_BKT)
+			tx.CreateBucketIfNotExists(BOARDS_BKT)
+			tx.CreateBucketIfNotExists(RULES_BKT)
+			tx.CreateBucketIfNotExists(HISTORY_BKT)
 
-		for row := range rows {
-			bassociations.Put([]byte(row[0]), []byte(row[1]))
+			return nil
+		})
+
+		if err := migrate(db); err != nil {
+			db.Close()
+			return nil, err
 		}
+	}
 
-		return nil
-	})
+	return &Library{
+		root:       root,
+		db:         db,
+		connectors: connectors,
+		excluded:   EXCLUDED_PREFIXES,
+	}, nil
 }
 
-func NewDefaultLibrary(connectors bool) (*Library, error) {
-	path := filepath.Join(GetLocalAppData(), "jcad")
-	os.MkdirAll(path, 0777)
+/*
+Set the designator prefixes that are never assembled
+*/
+func (l *Library) SetExcluded(prefixes []string) {
+	l.excluded = prefixes
+}
 
-	return NewLibrary(path, connectors)
+/*
+Determine whether the component is assembled with this library's settings
+*/
+func (l *Library) CanAssemble(bcomponent *BoardComponent) bool {
+	return bcomponent.Assembled(l.connectors, l.excluded)
 }
 
 /*
-Create or open library from root
+open the library for writing to create or migrate it, then close it
 */
-func NewLibrary(root string, connectors bool) (*Library, error) {
-	db, err := bolt.Open(filepath.Join(root, "jcad.db"), 0777, nil)
+func upgradeLibrary(root string, connectors bool, timeout time.Duration) error {
+	library, err := OpenLibrary(root, connectors, LibraryOptions{Timeout: timeout})
 	if err != nil {
-		return nil, err
+		return err
 	}
 
-	db.Update(func(tx *bolt.Tx) error {
-		tx.CreateBucketIfNotExists(COMPONENTS_BKT)
-		tx.CreateBucketIfNotExists(COMPONENTS_ASC_BKT)
-		tx.CreateBucketIfNotExists(PACKAGE_ASC_BKT)
-
-		return nil
-	})
+	return library.Close()
+}
 
-	return &Library{
-		root:       root,
-		db:         db,
-		connectors: connectors,
-	}, nil
+func (l *Library) Close() error {
+	return l.db.Close()
 }
 
 /*
@@ -183,6 +207,61 @@ type LibraryComponent struct {
 	Manufacturer string `json:"componentBrandEn"`
 	Description  string `json:"describe"`
 	Basic        bool
+	Stock        int64          `json:"stockCount"`
+	Prices       []LibraryPrice `json:"componentPrices"`
+	Sourcing     string
+	Attributes   []LibraryAttribute `json:"attributes"`
+	Datasheet    string             `json:"dataManualUrl"`
+	Image        string             `json:"componentImageUrl"`
+	MinimumOrder int                `json:"minPurchaseNum"`
+	LibraryType  string             `json:"componentLibraryType"` // base, preferred or expand
+}
+
+/*
+a parametric attribute of a part, e.g. Capacitance: 12pF
+*/
+type LibraryAttribute struct {
+	Name  string `json:"attribute_name_en"`
+	Value string `json:"attribute_value_name"`
+}
+
+/*
+price for a quantity range; End is -1 for the last range
+*/
+type LibraryPrice struct {
+	Start int     `json:"startNumber"`
+	End   int     `json:"endNumber"`
+	Price float64 `json:"productPrice"`
+}
+
+/*
+return the unit price when ordering qty components, or zero if unknown
+*/
+func (lc LibraryComponent) UnitPrice(qty int) float64 {
+	price := 0.0
+	for _, p := range lc.Prices {
+		if qty >= p.Start {
+			price = p.Price
+		}
+		if qty >= p.Start && (p.End < 0 || qty <= p.End) {
+			return p.Price
+		}
+	}
+
+	return price
+}
+
+/*
+return the value of the named attribute, or "" if the part does not have it
+*/
+func (lc LibraryComponent) Attribute(name string) string {
+	for _, attribute := range lc.Attributes {
+		if strings.EqualFold(attribute.Name, name) {
+			return attribute.Value
+		}
+	}
+
+	return ""
 }
 
 func (lc LibraryComponent) CID() string {
@@ -190,10 +269,115 @@ func (lc LibraryComponent) CID() string {
 }
 
 /*
-compute the key for a basic resistor, capacitor or inductor
+return whether the component is marked to skip
+*/
+func (lc LibraryComponent) IsSkipped() bool {
+	return lc.ID == 0 && lc.Sourcing == ""
+}
+
+/*
+return whether the component is consigned or globally sourced
+rather than an LCSC part
+*/
+func (lc LibraryComponent) IsSourced() bool {
+	return lc.Sourcing != ""
+}
+
+/*
+return the value stored in the association bucket:
+
+  - the CID for an LCSC part
+  - <sourcing>:<MPN> for a consigned or globally sourced part
+*/
+func (lc LibraryComponent) Reference() string {
+	if lc.IsSourced() {
+		return lc.Sourcing + ":" + lc.Part
+	}
+
+	return lc.CID()
+}
+
+/*
+parse a consigned or globally sourced reference
+
+returns nil if the reference is not consigned or globally sourced
+*/
+func ParseSourced(ref string) *LibraryComponent {
+	for _, sourcing := range []string{SOURCING_CONSIGNED, SOURCING_GLOBAL} {
+		if mpn, ok := strings.CutPrefix(ref, sourcing+":"); ok && mpn != "" {
+			return &LibraryComponent{Sourcing: sourcing, Part: mpn}
+		}
+	}
+
+	return nil
+}
+
+/*
+return the library type of the part: base, preferred or expand
+
+parts stored before the library type was known are basic or extended
+according to the basic flag
+*/
+func (lc LibraryComponent) Type() string {
+	if lc.ID == 0 || lc.IsSourced() {
+		return ""
+	}
+
+	if lc.LibraryType != "" {
+		return lc.LibraryType
+	}
+
+	if lc.Basic {
+		return LIBRARY_BASIC
+	}
+
+	return LIBRARY_EXTENDED
+}
+
+/*
+return the library type as it is shown to the user
+*/
+func (lc LibraryComponent) TypeName() string {
+	return LibraryTypeName(lc.Type())
+}
+
+/*
+return the name of a library type as it is shown to the user, e.g. basic for base
+*/
+func LibraryTypeName(libraryType string) string {
+	switch libraryType {
+	case LIBRARY_BASIC:
+		return "basic"
+	case LIBRARY_PREFERRED:
+		return "preferred"
+	case LIBRARY_EXTENDED:
+		return "extended"
+	}
+
+	return ""
+}
+
+/*
+return whether the part is assembled without a loading fee, which is the
+case for basic and preferred parts
+*/
+func (lc LibraryComponent) NoLoadingFee() bool {
+	return lc.Type() == LIBRARY_BASIC || lc.Type() == LIBRARY_PREFERRED
+}
+
+/*
+set the library type of the part, keeping the basic flag in step
+*/
+func (lc *LibraryComponent) SetType(libraryType string) {
+	lc.LibraryType = libraryType
+	lc.Basic = libraryType == LIBRARY_BASIC
+}
+
+/*
+compute the key for a basic or preferred resistor, capacitor or inductor
 */
 func (lc LibraryComponent) BasicKey() string {
-	if !lc.Basic {
+	if !lc.NoLoadingFee() {
 		return ""
 	}
 
@@ -236,6 +420,28 @@ func (lc LibraryComponent) Value() string {
 	return ""
 }
 
+/*
+return all of the basic components in the library
+*/
+func (l *Library) BasicComponents() []*LibraryComponent {
+	components := []*LibraryComponent{}
+	l.db.View(func(tx *bolt.Tx) error {
+		bcomponents := tx.Bucket(COMPONENTS_BKT)
+
+		return bcomponents.ForEach(func(key, val []byte) error {
+			component := LibraryComponent{}
+			if err := Unmarshal(val, &component); err != nil || !component.Basic {
+				return nil
+			}
+
+			components = append(components, &component)
+			return nil
+		})
+	})
+
+	return components
+}
+
 func (l *Library) Exact(cid string) *LibraryComponent {
 	if cid == "C0" {
 		return &LibraryComponent{}
@@ -263,24 +469,65 @@ returns:
   - nil if no associated component
   - LibraryComponent{ID:0} if this component is to be skipped
   - LibraryComponent{ID:int64} if an associated component is found
+  - LibraryComponent{Sourcing:string} if the component is consigned or globally sourced
 */
 func (l *Library) FindAssociated(bcomponent *BoardComponent) *LibraryComponent {
-	if !bcomponent.CanAssemble(l.connectors) {
+	if !l.CanAssemble(bcomponent) {
 		return &LibraryComponent{}
 	}
 
-	component := LibraryComponent{}
-	cid := ""
+	return l.FindKnown(bcomponent)
+}
+
+/*
+find the associated component regardless of whether it can be assembled
+
+returns nil if the component has never been associated
+*/
+func (l *Library) FindKnown(bcomponent *BoardComponent) *LibraryComponent {
+	if cid, ok := l.findExact(bcomponent); ok {
+		return l.Resolve(cid)
+	}
 
+	if rule := l.MatchRule(bcomponent); rule != nil {
+		return l.Resolve(rule.CID)
+	}
+
+	return nil
+}
+
+/*
+return the exact association of a board component and whether there is one
+*/
+func (l *Library) findExact(bcomponent *BoardComponent) (string, bool) {
+	cid, ok := "", false
 	l.db.View(func(tx *bolt.Tx) error {
 		bassociations := tx.Bucket(COMPONENTS_ASC_BKT)
-		bcomponents := tx.Bucket(COMPONENTS_BKT)
 
 		// fmt.Printf("FindAssociated: %s\n", bcomponent.Key())
 		if bytes := bassociations.Get(bcomponent.Key()); bytes != nil {
-			cid = string(bytes)
+			cid, ok = string(bytes), true
 		}
 
+		return nil
+	})
+
+	return cid, ok
+}
+
+/*
+return the component for the value stored in an association
+
+returns nil if the value is empty
+*/
+func (l *Library) Resolve(cid string) *LibraryComponent {
+	if lc := ParseSourced(cid); lc != nil {
+		return lc
+	}
+
+	component := LibraryComponent{}
+	l.db.View(func(tx *bolt.Tx) error {
+		bcomponents := tx.Bucket(COMPONENTS_BKT)
 		if bytes := bcomponents.Get([]byte(cid)); bytes != nil {
 			Unmarshal(bytes, &component)
 		}
@@ -297,20 +544,32 @@ func (l *Library) FindAssociated(bcomponent *BoardComponent) *LibraryComponent {
 	return &component
 }
 
+/*
+store a component in the library without associating it
+*/
+func (l *Library) Store(lcomponent *LibraryComponent) error {
+	if lcomponent.ID == 0 {
+		return nil
+	}
+
+	return l.db.Update(func(tx *bolt.Tx) error {
+		return putComponent(tx, lcomponent)
+	})
+}
+
 func (l *Library) Associate(bcomponent *BoardComponent, lcomponent *LibraryComponent) {
 	// fmt.Printf("associating %s with %s\n", string(bcomponent.Key()), lcomponent.CID())
 	l.db.Update(func(tx *bolt.Tx) error {
 		bassociations := tx.Bucket(COMPONENTS_ASC_BKT)
 		bfootprints := tx.Bucket(PACKAGE_ASC_BKT)
-		bcomponents := tx.Bucket(COMPONENTS_BKT)
 
-		bytes, err := Marshal(lcomponent)
-		if err != nil {
-			return err
+		value := ""
+		if lcomponent != nil {
+			value = lcomponent.Reference()
 		}
 
-		err = bcomponents.Put([]byte(lcomponent.CID()), bytes)
-		if err != nil {
+		old := string(bassociations.Get(bcomponent.Key()))
+		if err := l.recordChange(tx, bcomponent.StringKey(), old, value, 0); err != nil {
 			return err
 		}
 
@@ -318,11 +577,28 @@ func (l *Library) Associate(bcomponent *BoardComponent, lcomponent *LibraryCompo
 			return bassociations.Delete(bcomponent.Key())
 		}
 
+		if lcomponent.IsSourced() {
+			return bassociations.Put(bcomponent.Key(), []byte(lcomponent.Reference()))
+		}
+
+		err := putComponent(tx, lcomponent)
+		if err != nil {
+			return err
+		}
+
 		err = bassociations.Put(bcomponent.Key(), []byte(lcomponent.CID()))
 		if err != nil {
 			return err
 		}
 
+		/*
+			the latest package associated with a footprint is expected, so
+			that associating a footprint again corrects a mistaken package
+		*/
+		if lcomponent.Package == "" {
+			return nil
+		}
+
 		return bfootprints.Put([]byte(bcomponent.Package), []byte(lcomponent.Package))
 	})
 
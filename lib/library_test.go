@@ -0,0 +1,49 @@
+package lib
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestOpenLibraryLocking(t *testing.T) {
+	root := t.TempDir()
+
+	/* a read-only open of a missing library creates it first */
+	reader, err := OpenLibrary(root, false, LibraryOptions{ReadOnly: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if version := reader.SchemaVersion(); version != SCHEMA_VERSION {
+		t.Errorf("unexpected schema version: %d", version)
+	}
+
+	other, err := OpenLibrary(root, false, LibraryOptions{ReadOnly: true, Timeout: 100 * time.Millisecond})
+	if err != nil {
+		t.Fatalf("expected readers to share the library: %s", err)
+	}
+
+	if err := other.Store(&LibraryComponent{ID: 25804}); err == nil {
+		t.Errorf("expected write to a read-only library to fail")
+	}
+
+	_, err = OpenLibrary(root, false, LibraryOptions{Timeout: 100 * time.Millisecond})
+	if !errors.Is(err, ErrLibraryLocked) {
+		t.Errorf("expected writer to time out while the library is read, got %v", err)
+	}
+
+	reader.Close()
+	other.Close()
+
+	writer, err := OpenLibrary(root, false, LibraryOptions{Timeout: 100 * time.Millisecond})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer writer.Close()
+
+	_, err = OpenLibrary(root, false, LibraryOptions{ReadOnly: true, Timeout: 100 * time.Millisecond})
+	if !errors.Is(err, ErrLibraryLocked) {
+		t.Errorf("expected reader to time out while the library is written, got %v", err)
+	}
+}
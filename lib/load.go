@@ -0,0 +1,346 @@
+package lib
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"sort"
+
+	"github.com/boltdb/bolt"
+)
+
+var (
+	STAGING_BKT = []byte("staged-parts") // Contains the parts of a load that has not been committed
+
+	STAGED_PAGE_KEY = []byte("staged-page") // prefixes the last page of each list of parts in the staging bucket
+)
+
+/*
+the number of basic or preferred parts requested on each page while loading
+*/
+const BASIC_PAGE_SIZE = 100
+
+/*
+the number of parts staged in each transaction while importing
+*/
+const IMPORT_CHUNK_SIZE = 5000
+
+/*
+ErrNothingStaged is returned when committing a load without staged parts
+*/
+var ErrNothingStaged = errors.New("no parts have been loaded")
+
+/*
+The changes made by committing a load of parts
+*/
+type LoadSummary struct {
+	Added     int // new parts
+	Updated   int // parts whose record changed
+	Unchanged int
+	Demoted   int // parts that are no longer basic or preferred
+}
+
+/*
+return the key of the last staged page of a list of parts
+*/
+func stagedPageKey(list string) []byte {
+	return append(append([]byte{}, STAGED_PAGE_KEY...), ":"+list...)
+}
+
+/*
+delete the last staged page of every list
+*/
+func deleteStagedPages(tx *bolt.Tx) error {
+	bmeta := tx.Bucket(META_BKT)
+
+	keys := [][]byte{}
+	cur := bmeta.Cursor()
+	for key, _ := cur.Seek(STAGED_PAGE_KEY); key != nil && bytes.HasPrefix(key, STAGED_PAGE_KEY); key, _ = cur.Next() {
+		keys = append(keys, append([]byte{}, key...))
+	}
+
+	for _, key := range keys {
+		if err := bmeta.Delete(key); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+/*
+return the last page of a list of parts that was staged, or 0 if none were
+*/
+func (l *Library) StagedPage(list string) int {
+	page := 0
+	l.db.View(func(tx *bolt.Tx) error {
+		if val := tx.Bucket(META_BKT).Get(stagedPageKey(list)); len(val) == 8 && tx.Bucket(STAGING_BKT) != nil {
+			page = int(binary.BigEndian.Uint64(val))
+		}
+
+		return nil
+	})
+
+	return page
+}
+
+/*
+Add a page of a list of parts, e.g. the basic parts, to the staging bucket
+
+Pages are staged in their own transaction so that an interrupted load
+can resume after the last staged page of each list
+*/
+func (l *Library) StageParts(list string, page int, components []*LibraryComponent) error {
+	return l.db.Update(func(tx *bolt.Tx) error {
+		bstaging, err := tx.CreateBucketIfNotExists(STAGING_BKT)
+		if err != nil {
+			return err
+		}
+
+		for _, component := range components {
+			bytes, err := Marshal(component)
+			if err != nil {
+				return err
+			}
+
+			if err := bstaging.Put([]byte(component.CID()), bytes); err != nil {
+				return err
+			}
+		}
+
+		val := make([]byte, 8)
+		binary.BigEndian.PutUint64(val, uint64(page))
+
+		return tx.Bucket(META_BKT).Put(stagedPageKey(list), val)
+	})
+}
+
+/*
+Discard the staged parts
+*/
+func (l *Library) DiscardStaged() error {
+	return l.db.Update(func(tx *bolt.Tx) error {
+		if err := tx.DeleteBucket(STAGING_BKT); err != nil && err != bolt.ErrBucketNotFound {
+			return err
+		}
+
+		return deleteStagedPages(tx)
+	})
+}
+
+/*
+Import parts into the library at once, e.g. from the parts catalogue
+
+The parts are staged in chunks of IMPORT_CHUNK_SIZE and then committed
+together in the single transaction of CommitStaged, so an import that
+fails leaves the library unchanged.
+*/
+func (l *Library) ImportParts(components []*LibraryComponent) (LoadSummary, error) {
+	if err := l.DiscardStaged(); err != nil {
+		return LoadSummary{}, err
+	}
+
+	for page := 0; page*IMPORT_CHUNK_SIZE < len(components) || page == 0; page++ {
+		chunk := components[page*IMPORT_CHUNK_SIZE : min(len(components), (page+1)*IMPORT_CHUNK_SIZE)]
+		if err := l.StageParts("import", page+1, chunk); err != nil {
+			return LoadSummary{}, err
+		}
+	}
+
+	return l.CommitStaged()
+}
+
+/*
+change the associations of basic keys, removing those set to "", and record
+each change in the history so that it can be undone
+*/
+func (l *Library) setBasicKeys(tx *bolt.Tx, keys map[string]string) error {
+	bassociations := tx.Bucket(COMPONENTS_ASC_BKT)
+
+	sorted := make([]string, 0, len(keys))
+	for key := range keys {
+		sorted = append(sorted, key)
+	}
+	sort.Strings(sorted)
+
+	for _, key := range sorted {
+		cid := keys[key]
+		if err := l.recordChange(tx, key, string(bassociations.Get([]byte(key))), cid, 0); err != nil {
+			return err
+		}
+
+		var err error
+		if cid == "" {
+			err = bassociations.Delete([]byte(key))
+		} else {
+			err = bassociations.Put([]byte(key), []byte(cid))
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+/*
+Add the staged parts to the library in one transaction
+
+Records that changed are updated in place, keeping the details fetched
+for them. If any basic or preferred parts were staged, they replace the
+parts of that type in the library, and parts that are no longer basic or
+preferred are kept as extended parts.
+
+Basic and preferred parts are associated with their basic keys; where a
+basic and a preferred part have the same key, the basic part is used. The
+basic keys of parts that are no longer basic or preferred are removed
+unless another part takes them. These changes are recorded in the history
+so that they can be undone.
+*/
+func (l *Library) CommitStaged() (LoadSummary, error) {
+	summary := LoadSummary{}
+	err := l.db.Update(func(tx *bolt.Tx) error {
+		bstaging := tx.Bucket(STAGING_BKT)
+		if bstaging == nil {
+			return ErrNothingStaged
+		}
+
+		bcomponents := tx.Bucket(COMPONENTS_BKT)
+		bassociations := tx.Bucket(COMPONENTS_ASC_BKT)
+
+		staged := []*LibraryComponent{}
+		err := bstaging.ForEach(func(key, val []byte) error {
+			component := LibraryComponent{}
+			if err := Unmarshal(val, &component); err != nil {
+				return err
+			}
+
+			staged = append(staged, &component)
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+
+		/* the staged parts of each library type, by CID */
+		types := map[string]map[string]struct{}{
+			LIBRARY_BASIC:     {},
+			LIBRARY_PREFERRED: {},
+		}
+		for _, component := range staged {
+			if cids, ok := types[component.Type()]; ok {
+				cids[component.CID()] = struct{}{}
+			}
+
+			old := bcomponents.Get([]byte(component.CID()))
+			if old == nil {
+				summary.Added++
+				if err := putComponent(tx, component); err != nil {
+					return err
+				}
+
+				continue
+			}
+
+			/* lists do not include all of the details, so keep those that were fetched */
+			previous := LibraryComponent{}
+			Unmarshal(old, &previous)
+			if len(component.Attributes) == 0 {
+				component.Attributes = previous.Attributes
+			}
+
+			if component.MinimumOrder == 0 {
+				component.MinimumOrder = previous.MinimumOrder
+			}
+
+			if component.Datasheet == "" {
+				component.Datasheet = previous.Datasheet
+			}
+
+			if component.Image == "" {
+				component.Image = previous.Image
+			}
+
+			if updated, err := Marshal(component); err == nil && bytes.Equal(updated, old) {
+				summary.Unchanged++
+				continue
+			}
+
+			summary.Updated++
+			if err := putComponent(tx, component); err != nil {
+				return err
+			}
+		}
+
+		demoted := []*LibraryComponent{}
+		bcomponents.ForEach(func(key, val []byte) error {
+			component := LibraryComponent{}
+			if Unmarshal(val, &component) != nil {
+				return nil
+			}
+
+			if cids, ok := types[component.Type()]; ok && len(cids) > 0 {
+				if _, ok := cids[string(key)]; !ok {
+					demoted = append(demoted, &component)
+				}
+			}
+
+			return nil
+		})
+
+		/* the basic keys to change, with their new CIDs or "" to remove them */
+		keys := make(map[string]string)
+		for _, component := range demoted {
+			if key := component.BasicKey(); key != "" && string(bassociations.Get([]byte(key))) == component.CID() {
+				keys[key] = ""
+			}
+
+			component.SetType(LIBRARY_EXTENDED)
+			if err := putComponent(tx, component); err != nil {
+				return err
+			}
+		}
+		summary.Demoted = len(demoted)
+
+		/* associate the basic parts last so that they take the keys of preferred parts */
+		for _, libraryType := range []string{LIBRARY_PREFERRED, LIBRARY_BASIC} {
+			for _, component := range staged {
+				if component.Type() != libraryType {
+					continue
+				}
+
+				key := component.BasicKey()
+				if key == "" {
+					continue
+				}
+
+				/* a preferred part does not replace a basic part that was not staged */
+				if libraryType == LIBRARY_PREFERRED {
+					cid, ok := keys[key]
+					if !ok {
+						cid = string(bassociations.Get([]byte(key)))
+					}
+
+					existing := LibraryComponent{}
+					if cid != "" && Unmarshal(bcomponents.Get([]byte(cid)), &existing) == nil && existing.Type() == LIBRARY_BASIC {
+						continue
+					}
+				}
+
+				keys[key] = component.CID()
+			}
+		}
+
+		if err := l.setBasicKeys(tx, keys); err != nil {
+			return err
+		}
+
+		if err := tx.DeleteBucket(STAGING_BKT); err != nil {
+			return err
+		}
+
+		return deleteStagedPages(tx)
+	})
+
+	return summary, err
+}
@@ -0,0 +1,265 @@
+package lib
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestStageParts(t *testing.T) {
+	jlc, _ := newTestJLC(t)
+
+	page, err := jlc.SelectLibraryPage(context.Background(), LIBRARY_BASIC, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(page.Components) != 25 || page.Total != 25 || page.HasNext {
+		t.Fatalf("unexpected page: %d parts of %d", len(page.Components), page.Total)
+	}
+
+	root := t.TempDir()
+	library, err := NewLibrary(root, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	/* an extended part, a part that is no longer basic, and a basic part with details */
+	library.Store(&LibraryComponent{ID: 7593, Part: "NE555DR", Package: "SOIC-8", Description: "timer"})
+	library.Store(&LibraryComponent{ID: 99, Part: "OLD", Package: "0603", Description: "old", Basic: true})
+	library.Store(&LibraryComponent{
+		ID: 8056, Part: "ZMM3V3-M", Package: "LL-34", Description: "old description", Basic: true,
+		Attributes: []LibraryAttribute{{Name: "Voltage", Value: "3.3V"}},
+	})
+
+	if err := library.StageParts(LIBRARY_BASIC, 1, page.Components[:10]); err != nil {
+		t.Fatal(err)
+	}
+
+	/* nothing changes until the load is committed */
+	if lc := library.Exact("C11616"); lc.Part != "" {
+		t.Errorf("expected staged parts to be invisible, got %+v", lc)
+	}
+
+	/* an interrupted load resumes after the last staged page */
+	library.Close()
+	library, err = NewLibrary(root, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer library.Close()
+
+	if staged := library.StagedPage(LIBRARY_BASIC); staged != 1 {
+		t.Errorf("expected page 1 to be staged, got %d", staged)
+	}
+
+	if err := library.StageParts(LIBRARY_BASIC, 2, page.Components[10:]); err != nil {
+		t.Fatal(err)
+	}
+
+	summary, err := library.CommitStaged()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if summary != (LoadSummary{Added: 24, Updated: 1, Demoted: 1}) {
+		t.Errorf("unexpected summary: %+v", summary)
+	}
+
+	if lc := library.Exact("C7593"); lc.Part != "NE555DR" || lc.Basic {
+		t.Errorf("expected the extended part to be kept, got %+v", lc)
+	}
+
+	if lc := library.Exact("C99"); lc.Part != "OLD" || lc.Basic {
+		t.Errorf("expected the old part to be kept as extended, got %+v", lc)
+	}
+
+	if lc := library.Exact("C8056"); lc.Description == "old description" || lc.Attribute("Voltage") != "3.3V" || !lc.Basic {
+		t.Errorf("expected the part to be updated with its details kept, got %+v", lc)
+	}
+
+	if results := library.Search(SearchQuery{Text: []string{"0402wgf5103tce"}}); len(results) != 1 {
+		t.Errorf("expected the new part to be indexed, got %v", results)
+	}
+
+	if staged := library.StagedPage(LIBRARY_BASIC); staged != 0 {
+		t.Errorf("expected the staging to be removed, got page %d", staged)
+	}
+
+	/* loading the same parts again changes nothing */
+	summary, err = library.ImportParts(page.Components)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if summary != (LoadSummary{Unchanged: 25}) {
+		t.Errorf("unexpected summary: %+v", summary)
+	}
+
+	if _, err := library.CommitStaged(); !errors.Is(err, ErrNothingStaged) {
+		t.Errorf("expected nothing to be staged, got %v", err)
+	}
+}
+
+func TestPreferredParts(t *testing.T) {
+	jlc, s := newTestJLC(t)
+	ctx := context.Background()
+
+	/* a preferred part with the same value as a basic part, and one with a new value */
+	for _, raw := range []string{
+		`{"componentCode":"C2012","componentTypeEn":"Chip Resistor - Surface Mount","componentModelEn":"0603WAF120JT5E","componentSpecificationEn":"0603","describe":"100mW Thick Film Resistors 75V ±1% 1.2kΩ 0603","componentLibraryType":"expand","preferredComponentFlag":true,"stockCount":1000}`,
+		`{"componentCode":"C2047","componentTypeEn":"Chip Resistor - Surface Mount","componentModelEn":"0603WAF470JT5E","componentSpecificationEn":"0603","describe":"100mW Thick Film Resistors 75V ±1% 47Ω 0603","componentLibraryType":"expand","preferredComponentFlag":true,"stockCount":1000}`,
+		`{"componentCode":"C7593","componentTypeEn":"555 Timers","componentModelEn":"NE555DR","componentSpecificationEn":"SOIC-8","describe":"timer","componentLibraryType":"expand","stockCount":1000}`,
+	} {
+		if err := s.Add([]byte(raw)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	basic, err := jlc.SelectLibraryPage(ctx, LIBRARY_BASIC, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	preferred, err := jlc.SelectLibraryPage(ctx, LIBRARY_PREFERRED, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(preferred.Components) != 2 {
+		t.Fatalf("expected 2 preferred parts, got %d", len(preferred.Components))
+	}
+
+	for _, lc := range preferred.Components {
+		if lc.Type() != LIBRARY_PREFERRED || lc.Basic || !lc.NoLoadingFee() || lc.TypeName() != "preferred" {
+			t.Errorf("unexpected preferred part: %+v", lc)
+		}
+	}
+
+	found, err := jlc.FindComponents(ctx, ComponentQuery{LibraryType: LIBRARY_EXTENDED, Keyword: "NE555"})
+	if err != nil || len(found.Components) != 1 || found.Components[0].NoLoadingFee() {
+		t.Errorf("unexpected extended parts: %v %v", found, err)
+	}
+
+	library, err := NewLibrary(t.TempDir(), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer library.Close()
+
+	library.StageParts(LIBRARY_BASIC, 1, basic.Components)
+	library.StageParts(LIBRARY_PREFERRED, 1, preferred.Components)
+	if _, err := library.CommitStaged(); err != nil {
+		t.Fatal(err)
+	}
+
+	/* preferred parts are associated like basic parts, but basic parts take precedence */
+	resistor := func(value string) *LibraryComponent {
+		return library.FindKnown(&BoardComponent{Designator: "R1", Comment: value, Package: "R_0603_1608Metric"})
+	}
+
+	if lc := resistor("47"); lc == nil || lc.CID() != "C2047" {
+		t.Errorf("expected the preferred part to be associated, got %+v", lc)
+	}
+
+	if lc := resistor("1.2k"); lc == nil || lc.CID() != "C22765" {
+		t.Errorf("expected the basic part to be associated, got %+v", lc)
+	}
+
+	if issues := library.Diagnose(); len(issues) != 0 {
+		t.Errorf("unexpected issues: %v", issues)
+	}
+
+	results := library.Search(SearchQuery{Text: []string{"0603"}})
+	if len(results) < 2 || results[len(results)-1].Component.Type() != LIBRARY_PREFERRED {
+		t.Errorf("expected preferred parts after basic parts, got %v", results)
+	}
+
+	/* loading only the basic parts keeps the preferred parts */
+	summary, err := library.ImportParts(basic.Components)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if summary.Demoted != 0 || library.Exact("C2012").Type() != LIBRARY_PREFERRED {
+		t.Errorf("expected the preferred parts to be kept: %+v", summary)
+	}
+
+	/* a part that is no longer preferred becomes extended */
+	library.StageParts(LIBRARY_PREFERRED, 1, preferred.Components[:1])
+	if summary, err = library.CommitStaged(); err != nil {
+		t.Fatal(err)
+	}
+
+	if lc := library.Exact("C2047"); summary.Demoted != 1 || lc.Type() != LIBRARY_EXTENDED || lc.NoLoadingFee() {
+		t.Errorf("expected the part to become extended: %+v %+v", summary, lc)
+	}
+
+	if lc := resistor("47"); lc != nil {
+		t.Errorf("expected the association of the extended part to be removed, got %+v", lc)
+	}
+}
+
+func TestDroppedBasicParts(t *testing.T) {
+	jlc, _ := newTestJLC(t)
+
+	basic, err := jlc.SelectLibraryPage(context.Background(), LIBRARY_BASIC, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	library, err := NewLibrary(t.TempDir(), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer library.Close()
+
+	resistor := func() *LibraryComponent {
+		return library.FindKnown(&BoardComponent{Designator: "R1", Comment: "1.2k", Package: "R_0603_1608Metric"})
+	}
+
+	library.StageParts(LIBRARY_BASIC, 1, basic.Components)
+	if _, err := library.CommitStaged(); err != nil {
+		t.Fatal(err)
+	}
+
+	if lc := resistor(); lc == nil || lc.CID() != "C22765" {
+		t.Fatalf("expected the basic part to be associated, got %+v", lc)
+	}
+
+	/* load again without the resistor */
+	kept := []*LibraryComponent{}
+	for _, lc := range basic.Components {
+		if lc.CID() != "C22765" {
+			kept = append(kept, lc)
+		}
+	}
+
+	run := library.BeginRun("")
+	library.StageParts(LIBRARY_BASIC, 1, kept)
+	summary, err := library.CommitStaged()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if summary.Demoted != 1 || library.Exact("C22765").Type() != LIBRARY_EXTENDED {
+		t.Errorf("expected the part to become extended: %+v", summary)
+	}
+
+	if lc := resistor(); lc != nil {
+		t.Errorf("expected the association of the extended part to be removed, got %+v", lc)
+	}
+
+	changes := library.History(func(entry *HistoryEntry) bool { return entry.Run == run })
+	if len(changes) != 1 || changes[0].Old != "C22765" || changes[0].New != "" {
+		t.Fatalf("expected the removal to be recorded, got %+v", changes)
+	}
+
+	if conflicts, err := library.Undo(changes); err != nil || len(conflicts) != 0 {
+		t.Fatalf("failed to undo: %v %v", conflicts, err)
+	}
+
+	if lc := resistor(); lc == nil || lc.CID() != "C22765" {
+		t.Errorf("expected the association to be restored, got %+v", lc)
+	}
+}
@@ -0,0 +1,129 @@
+package lib
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+/*
+ErrOffline is returned for lookups that need JLCPCB when working offline
+*/
+var ErrOffline = errors.New("not available offline")
+
+/*
+OfflineSource looks up parts without a network connection, first in the
+cached JLCPCB responses and then in the library
+*/
+type OfflineSource struct {
+	library *Library // nil if the library is not open
+	jlc     *JLC
+}
+
+var _ ComponentSource = (*OfflineSource)(nil)
+
+/*
+Create an offline source from the library and the cache of the configuration
+*/
+func NewOfflineSource(library *Library, config JLCConfig) *OfflineSource {
+	jlc := NewConfiguredJLC(config)
+	jlc.offline = true
+
+	return &OfflineSource{library: library, jlc: jlc}
+}
+
+/*
+Search the cached results for the keyword together with the parts in the library
+*/
+func (o *OfflineSource) SelectComponentList(ctx context.Context, keyword string) (map[int64]*LibraryComponent, error) {
+	components, err := o.jlc.SelectComponentList(ctx, keyword)
+	if err != nil {
+		components = make(map[int64]*LibraryComponent)
+	}
+
+	if o.library != nil {
+		for _, result := range o.library.Search(SearchQuery{Text: tokenize(keyword), Limit: o.jlc.pageSize}) {
+			if _, ok := components[result.Component.ID]; !ok {
+				components[result.Component.ID] = result.Component
+			}
+		}
+	}
+
+	if len(components) == 0 {
+		return nil, fmt.Errorf("no cached results or library parts for %s: %w", keyword, ErrOffline)
+	}
+
+	return components, nil
+}
+
+/*
+return the cached page for the query, or else the matching parts in the
+library as a single page
+*/
+func (o *OfflineSource) FindComponents(ctx context.Context, query ComponentQuery) (*ComponentPage, error) {
+	if page, err := o.jlc.FindComponents(ctx, query); err == nil {
+		return page, nil
+	}
+
+	page := &ComponentPage{Page: max(query.Page, 1)}
+	if o.library == nil || page.Page > 1 {
+		return page, nil
+	}
+
+	category := query.Subcategory
+	if category == "" {
+		category = query.Category
+	}
+
+	results := o.library.Search(SearchQuery{
+		Text:         tokenize(query.Keyword + " " + strings.Join(query.Attributes, " ")),
+		Category:     category,
+		Package:      query.Package,
+		Manufacturer: query.Brand,
+		Basic:        query.LibraryType == LIBRARY_BASIC,
+	})
+	for _, result := range results {
+		if query.matches(result.Component) {
+			page.Components = append(page.Components, result.Component)
+		}
+	}
+
+	if len(page.Components) == 0 {
+		return nil, fmt.Errorf("no cached results or library parts: %w", ErrOffline)
+	}
+
+	return page, nil
+}
+
+/*
+The basic and preferred parts lists cannot be loaded offline
+*/
+func (o *OfflineSource) SelectLibraryPage(ctx context.Context, libraryType string, page int) (*ComponentPage, error) {
+	return o.jlc.SelectLibraryPage(ctx, libraryType, page)
+}
+
+/*
+return the cached detail of a part, or else the part in the library
+*/
+func (o *OfflineSource) GetComponentDetail(ctx context.Context, cid string) (*LibraryComponent, error) {
+	if component, err := o.jlc.GetComponentDetail(ctx, cid); err == nil {
+		return component, nil
+	}
+
+	if o.library != nil {
+		if component := o.library.Exact(cid); component.Description != "" {
+			return component, nil
+		}
+	}
+
+	return nil, fmt.Errorf("no cached detail or library part for %s: %w", cid, ErrOffline)
+}
+
+/*
+return the cached or library part, or an error wrapping ErrOffline so that a
+part that is not available offline is not associated
+*/
+func (o *OfflineSource) Exact(ctx context.Context, cid string) (*LibraryComponent, error) {
+	return o.GetComponentDetail(ctx, cid)
+}
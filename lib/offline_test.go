@@ -0,0 +1,102 @@
+package lib
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/boltdb/bolt"
+	"github.com/xoviat/jcad/lib/jlctest"
+)
+
+func TestOfflineSource(t *testing.T) {
+	s, err := jlctest.NewServer("../test-data")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	delay := time.Duration(0)
+	config := JLCConfig{
+		URL: s.BaseURL(), HTTPClient: s.Client(), Delay: &delay, Cache: t.TempDir(), CacheTTL: time.Hour,
+	}
+
+	/* fill the cache while online */
+	ctx := context.Background()
+	online := NewConfiguredJLC(config)
+	if _, err := online.SelectComponentList(ctx, "ZMM3V3"); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := online.GetComponentDetail(ctx, "C1547"); err != nil {
+		t.Fatal(err)
+	}
+	s.Close()
+
+	library, err := NewLibrary(t.TempDir(), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer library.Close()
+
+	library.Store(&LibraryComponent{
+		ID: 25804, Category: "Chip Resistor - Surface Mount", Part: "0603WAF1002T5E",
+		Package: "0603", Description: "10kΩ ±1% 100mW",
+	})
+
+	/* stale responses are used offline */
+	config.CacheTTL = time.Nanosecond
+	offline := NewOfflineSource(library, config)
+
+	if components, err := offline.SelectComponentList(ctx, "ZMM3V3"); err != nil || components[8056] == nil {
+		t.Errorf("expected the cached search, got %v %v", components, err)
+	}
+
+	if components, err := offline.SelectComponentList(ctx, "0603WAF1002T5E"); err != nil || components[25804] == nil {
+		t.Errorf("expected the library part, got %v %v", components, err)
+	}
+
+	if _, err := offline.SelectComponentList(ctx, "NE555"); !errors.Is(err, ErrOffline) {
+		t.Errorf("expected an offline error, got %v", err)
+	}
+
+	if lc, err := offline.GetComponentDetail(ctx, "C1547"); err != nil || lc.Attribute("Capacitance") != "12pF" {
+		t.Errorf("expected the cached detail, got %+v %v", lc, err)
+	}
+
+	if lc, err := offline.GetComponentDetail(ctx, "C25804"); err != nil || lc.Part != "0603WAF1002T5E" {
+		t.Errorf("expected the library part, got %+v %v", lc, err)
+	}
+
+	if _, err := offline.GetComponentDetail(ctx, "C7593"); !errors.Is(err, ErrOffline) {
+		t.Errorf("expected an offline error, got %v", err)
+	}
+
+	/* a part that is not available offline is not selected */
+	if lc, err := SelectComponent(ctx, offline, nil, "C7593"); !errors.Is(err, ErrOffline) || lc != nil {
+		t.Errorf("expected an offline error, got %+v %v", lc, err)
+	}
+
+	if _, err := offline.SelectLibraryPage(ctx, LIBRARY_BASIC, 1); !errors.Is(err, ErrOffline) {
+		t.Errorf("expected an offline error, got %v", err)
+	}
+
+	/* a part that cannot be fetched offline is left for later */
+	library.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(COMPONENTS_ASC_BKT).Put([]byte("U:NE555:SOIC-8"), []byte("C7593"))
+	})
+	remaining, err := library.Repair(library.Diagnose(), func(cid string) (*LibraryComponent, error) {
+		return offline.GetComponentDetail(ctx, cid)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(remaining) != 1 || remaining[0].Kind != ISSUE_MISSING {
+		t.Errorf("expected the missing part to remain, got %+v", remaining)
+	}
+
+	if lc := library.FindAssociated(&BoardComponent{Designator: "U1", Comment: "NE555", Package: "SOIC-8"}); lc == nil {
+		t.Errorf("expected the association to be kept")
+	}
+}
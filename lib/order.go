@@ -0,0 +1,203 @@
+package lib
+
+import (
+	"encoding/csv"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+)
+
+/*
+the loading fee of each unique extended part on a board in economic assembly
+*/
+const LOADING_FEE = 3.0
+
+/*
+Represents a board resolved against the library without user input
+
+Boards are identified by the normalised path of the PCB because boards in
+different directories can have the same name
+*/
+type Board struct {
+	PCB        string
+	Name       string
+	Quantity   int
+	Placed     []*BoardComponent
+	BOM        BOM
+	Consigned  ConsignedBOM
+	Hand       HandBOM
+	Unresolved []*BoardComponent
+}
+
+/*
+Resolve the components of a board using the existing associations
+
+Components without an association are collected in Unresolved
+*/
+func ResolveBoard(pcb, name string, quantity int, components []*BoardComponent, am *AssocationMap) *Board {
+	board := &Board{
+		PCB:       pcb,
+		Name:      name,
+		Quantity:  quantity,
+		BOM:       make(BOM),
+		Consigned: make(ConsignedBOM),
+		Hand:      make(HandBOM),
+	}
+
+	for _, component := range components {
+		lc := am.FindAssociated(component)
+		if lc == nil {
+			board.Unresolved = append(board.Unresolved, component)
+			continue
+		}
+
+		if lc.IsSkipped() {
+			board.Hand.AddComponent(component, am.FindKnown(component))
+			continue
+		}
+
+		board.Placed = append(board.Placed, component)
+		AddToBOM(board.BOM, board.Consigned, component, lc)
+	}
+
+	return board
+}
+
+/*
+A line of a BOM combined over several boards
+*/
+type MergedEntry struct {
+	Component *LibraryComponent
+	Comment   string
+	Package   string
+	Quantity  int
+	Boards    map[string]int // by the PCB of the board
+}
+
+/*
+return the cost of the entry at the combined quantity
+*/
+func (me MergedEntry) Cost() float64 {
+	return float64(me.Quantity) * me.Component.UnitPrice(me.Quantity)
+}
+
+/*
+return whether JLCPCB has enough stock for the combined quantity
+*/
+func (me MergedEntry) InStock() bool {
+	return me.Component.Stock >= int64(me.Quantity)
+}
+
+type MergedBOM map[int64]*MergedEntry
+
+/*
+add the components of a board, multiplied by the board quantity
+*/
+func (mb MergedBOM) AddBoard(board *Board) {
+	for id, entry := range board.BOM {
+		if _, ok := mb[id]; !ok {
+			mb[id] = &MergedEntry{
+				Component: entry.Component,
+				Comment:   entry.Comment,
+				Package:   entry.Package,
+				Boards:    make(map[string]int),
+			}
+		}
+
+		quantity := len(entry.Designators) * board.Quantity
+		mb[id].Quantity += quantity
+		mb[id].Boards[board.PCB] += quantity
+	}
+}
+
+func (mb MergedBOM) IDs() []int64 {
+	ids := make([]int64, 0, len(mb))
+	for id := range mb {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+
+	return ids
+}
+
+func (mb MergedBOM) Cost() float64 {
+	cost := 0.0
+	for _, entry := range mb {
+		cost += entry.Cost()
+	}
+
+	return cost
+}
+
+/*
+return the loading fees of the extended parts, which are charged for each
+board that uses them
+*/
+func (mb MergedBOM) LoadingFees() float64 {
+	fees := 0.0
+	for _, entry := range mb {
+		if entry.Component.Type() == LIBRARY_EXTENDED {
+			fees += LOADING_FEE * float64(len(entry.Boards))
+		}
+	}
+
+	return fees
+}
+
+/*
+Write the combined BOM with a quantity column for each board
+*/
+func WriteMergedBOM(dst string, mb MergedBOM, boards []*Board) error {
+	fp, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+	defer fp.Close()
+
+	writer := csv.NewWriter(fp)
+
+	/* boards with the same name are told apart by their path */
+	names := make(map[string]int)
+	for _, board := range boards {
+		names[board.Name]++
+	}
+
+	header := []string{"LCSC Part #", "Library Type", "Comment", "Footprint", "Description"}
+	for _, board := range boards {
+		name := board.Name
+		if names[name] > 1 {
+			name = board.PCB
+		}
+
+		header = append(header, fmt.Sprintf("%s (x%d)", name, board.Quantity))
+	}
+	header = append(header, "Quantity", "Stock", "Unit Price", "Cost")
+	writer.Write(header)
+
+	for _, id := range mb.IDs() {
+		entry := mb[id]
+
+		row := []string{
+			entry.Component.CID(),
+			entry.Component.TypeName(),
+			entry.Comment,
+			entry.Package,
+			entry.Component.Description,
+		}
+		for _, board := range boards {
+			row = append(row, strconv.Itoa(entry.Boards[board.PCB]))
+		}
+		row = append(row,
+			strconv.Itoa(entry.Quantity),
+			strconv.FormatInt(entry.Component.Stock, 10),
+			fmt.Sprintf("%1.4f", entry.Component.UnitPrice(entry.Quantity)),
+			fmt.Sprintf("%1.2f", entry.Cost()),
+		)
+
+		writer.Write(row)
+	}
+
+	writer.Flush()
+	return writer.Error()
+}
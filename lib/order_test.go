@@ -0,0 +1,64 @@
+package lib
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestMergedBOM(t *testing.T) {
+	lc := &LibraryComponent{
+		ID:    1525,
+		Stock: 25,
+		Prices: []LibraryPrice{
+			{Start: 1, End: 19, Price: 0.002},
+			{Start: 20, End: -1, Price: 0.001},
+		},
+	}
+
+	boards := []*Board{
+		{PCB: "a/board.kicad_pcb", Name: "board", Quantity: 10, BOM: BOM{}},
+		{PCB: "b/board.kicad_pcb", Name: "board", Quantity: 5, BOM: BOM{}},
+	}
+	boards[0].BOM.AddComponent(&BoardComponent{Designator: "C1", Comment: "100n"}, lc)
+	boards[0].BOM.AddComponent(&BoardComponent{Designator: "C2", Comment: "100n"}, lc)
+	boards[1].BOM.AddComponent(&BoardComponent{Designator: "C1", Comment: "100n"}, lc)
+
+	merged := make(MergedBOM)
+	for _, board := range boards {
+		merged.AddBoard(board)
+	}
+
+	entry := merged[lc.ID]
+	/* boards with the same name in different directories are kept apart */
+	if entry.Quantity != 25 || entry.Boards["a/board.kicad_pcb"] != 20 || entry.Boards["b/board.kicad_pcb"] != 5 {
+		t.Fatalf("unexpected quantities: %d %v", entry.Quantity, entry.Boards)
+	}
+
+	if price := lc.UnitPrice(entry.Quantity); price != 0.001 {
+		t.Errorf("unexpected unit price: %f", price)
+	}
+
+	if price := lc.UnitPrice(5); price != 0.002 {
+		t.Errorf("unexpected unit price: %f", price)
+	}
+
+	if !entry.InStock() {
+		t.Errorf("expected entry to be in stock")
+	}
+
+	/* the extended part has a loading fee on each board */
+	if fees := merged.LoadingFees(); fees != 2*LOADING_FEE {
+		t.Errorf("unexpected loading fees: %1.2f", fees)
+	}
+
+	path := filepath.Join(t.TempDir(), "merged.csv")
+	if err := WriteMergedBOM(path, merged, boards); err != nil {
+		t.Fatal(err)
+	}
+
+	rows := readTestCSV(t, path)
+	if len(rows) != 2 || rows[0][5] != "a/board.kicad_pcb (x10)" || rows[0][6] != "b/board.kicad_pcb (x5)" ||
+		rows[1][5] != "20" || rows[1][6] != "5" {
+		t.Errorf("unexpected merged BOM: %v", rows)
+	}
+}
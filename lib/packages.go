@@ -0,0 +1,209 @@
+package lib
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/boltdb/bolt"
+)
+
+var (
+	rePackageSize  *regexp.Regexp = regexp.MustCompile(`(?:^|[^0-9])(01005|0201|0402|0603|0805|1206|1210|1812|2010|2512)(?:[^0-9]|$)`)
+	rePackageToken *regexp.Regexp = regexp.MustCompile(`[a-z]+|[0-9]+`)
+	rePackageDrop  *regexp.Regexp = regexp.MustCompile(`^([0-9.]+x[0-9.]+(mm)?|[0-9.]+mil|[0-9.]+mm|metric)$`)
+	rePackageLeads *regexp.Regexp = regexp.MustCompile(`^([0-9]+)l$`)
+)
+
+/*
+packages whose pin count is implied when it is not given, e.g. SOT-23 is SOT-23-3
+*/
+var PACKAGE_PIN_COUNTS = map[string]string{
+	"sot-23-3":  "sot-23",
+	"sot-223-3": "sot-223",
+	"sot-223-4": "sot-223",
+	"sot-323-3": "sot-323",
+	"sot-89-3":  "sot-89",
+	"sod-123-2": "sod-123",
+}
+
+/*
+return the package without its dimensions, separators and implied pin
+count, e.g. sot-23 for SOT-23-3L and soic-8 for SOIC-8_150mil
+*/
+func normalizePackage(pkg string) string {
+	tokens := []string{}
+	for _, field := range strings.FieldsFunc(strings.ToLower(pkg), func(r rune) bool {
+		return !(r >= 'a' && r <= 'z' || r >= '0' && r <= '9' || r == '.')
+	}) {
+		if rePackageDrop.MatchString(field) {
+			continue
+		}
+
+		/* the number of leads, e.g. 3L */
+		if match := rePackageLeads.FindStringSubmatch(field); match != nil {
+			field = match[1]
+		}
+
+		tokens = append(tokens, rePackageToken.FindAllString(field, -1)...)
+	}
+
+	normalized := strings.Join(tokens, "-")
+	if implied, ok := PACKAGE_PIN_COUNTS[normalized]; ok {
+		return implied
+	}
+
+	return normalized
+}
+
+/*
+return the imperial chip size (e.g. 0603) of a package, if any
+*/
+func packageSize(pkg string) string {
+	if match := rePackageSize.FindStringSubmatch(pkg); match != nil {
+		return match[1]
+	}
+
+	return ""
+}
+
+/*
+return whether a JLCPCB package matches the expected package
+
+chip sizes are compared by size, and other packages by their names without
+dimensions or an implied pin count. Unknown packages always match.
+*/
+func PackagesMatch(expected, actual string) bool {
+	if expected == "" || actual == "" {
+		return true
+	}
+
+	if esize, asize := packageSize(expected), packageSize(actual); esize != "" && asize != "" {
+		return esize == asize
+	}
+
+	return normalizePackage(expected) == normalizePackage(actual)
+}
+
+/*
+return the JLCPCB package expected for a KiCad footprint, or "" if unknown
+
+basic footprints are recognized by name, and other footprints are looked
+up in the package associations
+*/
+func (l *Library) ExpectedPackage(footprint string) string {
+	for size, suffix := range BASIC_FP_MAP {
+		if strings.Contains(footprint, suffix) {
+			return size
+		}
+	}
+
+	pkg := ""
+	l.db.View(func(tx *bolt.Tx) error {
+		if bytes := tx.Bucket(PACKAGE_ASC_BKT).Get([]byte(footprint)); bytes != nil {
+			pkg = string(bytes)
+		}
+
+		return nil
+	})
+
+	return pkg
+}
+
+/*
+return an error if the package of the library component does not match
+the footprint of the board component
+*/
+func (l *Library) CheckPackage(bcomponent *BoardComponent, lcomponent *LibraryComponent) error {
+	if lcomponent == nil || lcomponent.ID == 0 {
+		return nil
+	}
+
+	expected := l.ExpectedPackage(bcomponent.Package)
+	if !PackagesMatch(expected, lcomponent.Package) {
+		return fmt.Errorf(
+			"footprint %s is expected to be %s but %s is %s",
+			bcomponent.Package, expected, lcomponent.CID(), lcomponent.Package,
+		)
+	}
+
+	return nil
+}
+
+/*
+return the components whose package matches the footprint of the board
+component, or all of the components if none match
+*/
+func (l *Library) FilterPackages(
+	bcomponent *BoardComponent, components map[int64]*LibraryComponent,
+) map[int64]*LibraryComponent {
+	expected := l.ExpectedPackage(bcomponent.Package)
+	if expected == "" {
+		return components
+	}
+
+	filtered := make(map[int64]*LibraryComponent)
+	for id, component := range components {
+		if PackagesMatch(expected, component.Package) {
+			filtered[id] = component
+		}
+	}
+
+	if len(filtered) == 0 {
+		return components
+	}
+
+	return filtered
+}
+
+/*
+An association whose component package does not match the footprint
+*/
+type PackageMismatch struct {
+	Key       string
+	Footprint string
+	CID       string
+	Expected  string
+	Actual    string
+}
+
+/*
+check the package of every associated component in the library
+*/
+func (l *Library) ValidatePackages() []PackageMismatch {
+	keys := make(map[string]string)
+	l.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(COMPONENTS_ASC_BKT).ForEach(func(key, val []byte) error {
+			keys[string(key)] = string(val)
+			return nil
+		})
+	})
+
+	mismatches := []PackageMismatch{}
+	for key, cid := range keys {
+		parts := strings.SplitN(key, ":", 3)
+		if len(parts) != 3 {
+			continue
+		}
+
+		lc := l.Resolve(cid)
+		if lc == nil || lc.ID == 0 {
+			continue
+		}
+
+		expected := l.ExpectedPackage(parts[2])
+		if !PackagesMatch(expected, lc.Package) {
+			mismatches = append(mismatches, PackageMismatch{
+				Key:       key,
+				Footprint: parts[2],
+				CID:       cid,
+				Expected:  expected,
+				Actual:    lc.Package,
+			})
+		}
+	}
+
+	sort.Slice(mismatches, func(i, j int) bool { return mismatches[i].Key < mismatches[j].Key })
+	return mismatches
+}
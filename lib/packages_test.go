@@ -0,0 +1,73 @@
+package lib
+
+import (
+	"testing"
+)
+
+func TestPackagesMatch(t *testing.T) {
+	for _, c := range []struct {
+		expected, actual string
+		match            bool
+	}{
+		{"0603", "0603", true},
+		{"0603", "0402", false},
+		{"0805", "0805(2012 Metric)", true},
+		{"SOT-23-3", "SOT-23", true},
+		{"SOT-23", "SOT-23-3L", true},
+		{"SOT-23", "SOT-223", false},
+		{"SOT-23", "SOT-23-5", false},
+		{"SOT-23-5", "SOT-23-6", false},
+		{"SOT-223", "SOT-223-3", true},
+		{"SSOP-20", "TSSOP-20", false},
+		{"QFN-16", "QFN-16-EP(3x3)", false},
+		{"QFN-16-EP", "QFN-16-EP(3x3)", true},
+		{"LQFN-56", "QFN-56", false},
+		{"SOIC-8", "SOIC-8_150mil", true},
+		{"TQFP-32", "TQFP-32(7x7)", true},
+		{"sot23", "SOT-23", true},
+		{"", "0402", true},
+	} {
+		if match := PackagesMatch(c.expected, c.actual); match != c.match {
+			t.Errorf("PackagesMatch(%s, %s) = %t", c.expected, c.actual, match)
+		}
+	}
+}
+
+func TestValidatePackages(t *testing.T) {
+	library, err := NewLibrary(t.TempDir(), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer library.Close()
+
+	r1 := &BoardComponent{Designator: "R1", Comment: "10k", Package: "R_0603_1608Metric"}
+	u1 := &BoardComponent{Designator: "U1", Comment: "AMS1117-3.3", Package: "SOT-223-3_TabPin2"}
+	u2 := &BoardComponent{Designator: "U2", Comment: "AP2112K-3.3", Package: "SOT-223-3_TabPin2"}
+
+	library.Associate(r1, &LibraryComponent{ID: 25744, Package: "0402"})
+	library.Associate(u1, &LibraryComponent{ID: 51118, Package: "SOT-23-5"})
+	library.Associate(u2, &LibraryComponent{ID: 51118, Package: "SOT-23-5"})
+
+	/* associating the footprint again corrects the expected package */
+	library.Associate(u1, &LibraryComponent{ID: 6186, Package: "SOT-223"})
+	if expected := library.ExpectedPackage(u1.Package); expected != "SOT-223" {
+		t.Errorf("expected the package to be corrected, got %s", expected)
+	}
+
+	if err := library.CheckPackage(r1, &LibraryComponent{ID: 25744, Package: "0402"}); err == nil {
+		t.Errorf("expected 0402 part on 0603 footprint to be rejected")
+	}
+
+	mismatches := library.ValidatePackages()
+	if len(mismatches) != 2 || mismatches[0].CID != "C25744" || mismatches[1].CID != "C51118" {
+		t.Errorf("unexpected mismatches: %+v", mismatches)
+	}
+
+	filtered := library.FilterPackages(u2, map[int64]*LibraryComponent{
+		6186:  {ID: 6186, Package: "SOT-223"},
+		51118: {ID: 51118, Package: "SOT-23-5"},
+	})
+	if _, ok := filtered[6186]; !ok || len(filtered) != 1 {
+		t.Errorf("unexpected filtered components: %+v", filtered)
+	}
+}
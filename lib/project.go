@@ -0,0 +1,129 @@
+package lib
+
+import (
+	"bufio"
+	"encoding/csv"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+/*
+the name of the project association file, stored next to the board
+*/
+const PROJECT_ASSOCIATIONS = "jcad-associations.csv"
+
+/*
+ProjectAssociations contains the associations for a single project
+
+They override the associations in the library so that a board can
+use a different part for a key without affecting other projects.
+The file is sorted so that it can be committed with the design.
+*/
+type ProjectAssociations struct {
+	path         string
+	associations map[string]string
+}
+
+/*
+return the path of the project association file for a board
+*/
+func ProjectAssociationsPath(pcb string) string {
+	return filepath.Join(filepath.Dir(pcb), PROJECT_ASSOCIATIONS)
+}
+
+/*
+Load project associations from path
+
+A missing file is treated as a project without associations
+*/
+func LoadProjectAssociations(path string) (*ProjectAssociations, error) {
+	pa := &ProjectAssociations{
+		path:         path,
+		associations: make(map[string]string),
+	}
+
+	fp, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return pa, nil
+	} else if err != nil {
+		return nil, err
+	}
+	defer fp.Close()
+
+	reader := csv.NewReader(bufio.NewReader(fp))
+	reader.FieldsPerRecord = -1
+	for line, err := reader.Read(); err != io.EOF; line, err = reader.Read() {
+		if err != nil {
+			return nil, err
+		}
+
+		if len(line) < 2 || strings.TrimSpace(line[0]) == "Key" {
+			continue
+		}
+
+		pa.associations[strings.TrimSpace(line[0])] = strings.TrimSpace(line[1])
+	}
+
+	return pa, nil
+}
+
+func (pa *ProjectAssociations) Path() string {
+	return pa.path
+}
+
+func (pa *ProjectAssociations) Get(key string) (string, bool) {
+	cid, ok := pa.associations[key]
+
+	return cid, ok
+}
+
+func (pa *ProjectAssociations) Set(key, cid string) {
+	pa.associations[key] = cid
+}
+
+func (pa *ProjectAssociations) Delete(key string) {
+	delete(pa.associations, key)
+}
+
+func (pa *ProjectAssociations) Keys() []string {
+	keys := make([]string, 0, len(pa.associations))
+	for key := range pa.associations {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	return keys
+}
+
+/*
+Save the project associations, sorted by key
+
+The file is removed if there are no associations
+*/
+func (pa *ProjectAssociations) Save() error {
+	if len(pa.associations) == 0 {
+		if err := os.Remove(pa.path); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+
+		return nil
+	}
+
+	fp, err := os.Create(pa.path)
+	if err != nil {
+		return err
+	}
+	defer fp.Close()
+
+	writer := csv.NewWriter(fp)
+	writer.Write([]string{"Key", "LCSC Part #"})
+	for _, key := range pa.Keys() {
+		writer.Write([]string{key, pa.associations[key]})
+	}
+
+	writer.Flush()
+	return writer.Error()
+}
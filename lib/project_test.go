@@ -0,0 +1,66 @@
+package lib
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestProjectAssociations(t *testing.T) {
+	root := t.TempDir()
+
+	library, err := NewLibrary(root, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer library.Close()
+
+	r1 := &BoardComponent{Designator: "R1", Comment: "10k", Package: "R_0402_1005Metric"}
+	r2 := &BoardComponent{Designator: "R2", Comment: "4.7k", Package: "R_0402_1005Metric"}
+
+	library.Associate(r1, &LibraryComponent{ID: 25744, Description: "10kΩ"})
+	library.Associate(r2, &LibraryComponent{ID: 25900, Description: "4.7kΩ"})
+
+	path := filepath.Join(root, PROJECT_ASSOCIATIONS)
+	project, _ := LoadProjectAssociations(path)
+	project.Set(r1.StringKey(), "C60490")
+	if err := project.Save(); err != nil {
+		t.Fatal(err)
+	}
+
+	project, err = LoadProjectAssociations(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	am := NewProjectAssociationMap(library, project)
+	if lc := am.FindAssociated(r1); lc == nil || lc.ID != 60490 {
+		t.Errorf("expected project association to override library: %+v", lc)
+	}
+
+	if lc := am.FindAssociated(r2); lc == nil || lc.ID != 25900 {
+		t.Errorf("expected library association: %+v", lc)
+	}
+
+	/* associating a pinned key updates the project, not the library */
+	if err := am.Associate(r1, &LibraryComponent{ID: 25741}); err != nil {
+		t.Fatal(err)
+	}
+	if cid, _ := project.Get(r1.StringKey()); cid != "C25741" {
+		t.Errorf("expected project association to be updated: %s", cid)
+	}
+
+	if lc := library.FindAssociated(r1); lc == nil || lc.ID != 25744 {
+		t.Errorf("expected library association to be unchanged: %+v", lc)
+	}
+
+	/* the association fails if the project cannot be saved */
+	os.Remove(path)
+	if err := os.Mkdir(path, 0777); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := am.Associate(r1, &LibraryComponent{ID: 25744}); err == nil {
+		t.Errorf("expected the project save to fail")
+	}
+}
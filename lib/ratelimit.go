@@ -0,0 +1,75 @@
+package lib
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+/*
+A token bucket that limits the rate of requests
+
+Up to burst requests can be made at once, after which requests are
+spaced by interval
+*/
+type rateLimiter struct {
+	lock     sync.Mutex
+	interval time.Duration // the time to earn a token; zero for no limit
+	burst    float64
+	tokens   float64
+	last     time.Time
+}
+
+func newRateLimiter(interval time.Duration, burst int) *rateLimiter {
+	if burst < 1 {
+		burst = 1
+	}
+
+	return &rateLimiter{
+		interval: interval,
+		burst:    float64(burst),
+		tokens:   float64(burst),
+		last:     time.Now(),
+	}
+}
+
+/*
+Wait until a request can be made, or the context is done
+*/
+func (r *rateLimiter) Wait(ctx context.Context) error {
+	if r.interval <= 0 {
+		return ctx.Err()
+	}
+
+	/* take a token, which may leave the bucket in debt until it is earned */
+	r.lock.Lock()
+	now := time.Now()
+	r.tokens = min(r.burst, r.tokens+float64(now.Sub(r.last))/float64(r.interval))
+	r.last = now
+	r.tokens--
+
+	wait := time.Duration(0)
+	if r.tokens < 0 {
+		wait = time.Duration(-r.tokens * float64(r.interval))
+	}
+	r.lock.Unlock()
+
+	if wait == 0 {
+		return ctx.Err()
+	}
+
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		/* give back the token that was not used */
+		r.lock.Lock()
+		r.tokens++
+		r.lock.Unlock()
+
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
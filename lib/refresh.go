@@ -0,0 +1,144 @@
+package lib
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/boltdb/bolt"
+)
+
+const (
+	REFRESH_DISCONTINUED = "discontinued" // JLCPCB no longer has the part
+	REFRESH_EXTENDED     = "extended"     // a basic or preferred part that is now extended
+	REFRESH_LOW_STOCK    = "low-stock"    // a part with less stock than the threshold
+)
+
+/*
+the stock below which a refreshed part is reported
+*/
+const REFRESH_MIN_STOCK = 100
+
+/*
+A change to an associated part that needs attention
+*/
+type RefreshChange struct {
+	Kind   string
+	CID    string
+	Part   string
+	Detail string
+}
+
+/*
+return the part numbers referenced by the associations, in order
+*/
+func (l *Library) AssociatedCIDs() []string {
+	found := make(map[string]struct{})
+	l.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(COMPONENTS_ASC_BKT).ForEach(func(key, val []byte) error {
+			if reCID.Match(val) {
+				found[string(val)] = struct{}{}
+			}
+
+			return nil
+		})
+	})
+
+	cids := make([]string, 0, len(found))
+	for cid := range found {
+		cids = append(cids, cid)
+	}
+	sort.Strings(cids)
+
+	return cids
+}
+
+/*
+return the part numbers used by a board when it was last generated
+*/
+func (l *Library) BoardCIDs(board string) []string {
+	cids := []string{}
+	l.db.View(func(tx *bolt.Tx) error {
+		if val := tx.Bucket(BOARDS_BKT).Get([]byte(board)); val != nil {
+			Unmarshal(val, &cids)
+		}
+
+		return nil
+	})
+
+	return cids
+}
+
+/*
+Update the stock, prices and library type of a part with its current
+detail, or with nil if JLCPCB no longer has the part, i.e. it has no
+detail for it, and return the changes that need attention
+
+Each part is updated in its own transaction so that a refresh can be
+interrupted at any point. The details that JLCPCB did not return are kept.
+*/
+func (l *Library) RefreshPart(cid string, lc *LibraryComponent, minStock int64) ([]RefreshChange, error) {
+	changes := []RefreshChange{}
+	err := l.db.Update(func(tx *bolt.Tx) error {
+		previous := LibraryComponent{}
+		if val := tx.Bucket(COMPONENTS_BKT).Get([]byte(cid)); val != nil {
+			Unmarshal(val, &previous)
+		}
+
+		if lc == nil {
+			changes = append(changes, RefreshChange{
+				Kind: REFRESH_DISCONTINUED, CID: cid, Part: previous.Part, Detail: "not found at JLCPCB",
+			})
+
+			if previous.ID == 0 || previous.Stock == 0 {
+				return nil
+			}
+
+			previous.Stock = 0
+			return putComponent(tx, &previous)
+		}
+
+		if previous.ID != 0 {
+			if len(lc.Attributes) == 0 {
+				lc.Attributes = previous.Attributes
+			}
+
+			if lc.Datasheet == "" {
+				lc.Datasheet = previous.Datasheet
+			}
+
+			if lc.Image == "" {
+				lc.Image = previous.Image
+			}
+
+			if lc.LibraryType == "" {
+				lc.SetType(previous.Type())
+			}
+
+			if previous.NoLoadingFee() && !lc.NoLoadingFee() {
+				changes = append(changes, RefreshChange{
+					Kind: REFRESH_EXTENDED, CID: cid, Part: lc.Part,
+					Detail: fmt.Sprintf("%s part is now %s", previous.TypeName(), lc.TypeName()),
+				})
+
+				/* extended parts are not associated by their basic keys */
+				key := previous.BasicKey()
+				if key != "" && string(tx.Bucket(COMPONENTS_ASC_BKT).Get([]byte(key))) == cid {
+					if err := l.setBasicKeys(tx, map[string]string{key: ""}); err != nil {
+						return err
+					}
+				}
+			}
+		}
+
+		if lc.Stock < minStock {
+			changes = append(changes, RefreshChange{
+				Kind: REFRESH_LOW_STOCK, CID: cid, Part: lc.Part,
+				Detail: fmt.Sprintf("stock %d (was %d)", lc.Stock, previous.Stock),
+			})
+		}
+
+		return putComponent(tx, lc)
+	})
+
+	return changes, err
+}
@@ -0,0 +1,135 @@
+package lib
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/boltdb/bolt"
+	"github.com/xoviat/jcad/lib/jlctest"
+)
+
+func TestRefreshPart(t *testing.T) {
+	s, err := jlctest.NewServer("../test-data")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	s.Add([]byte(`{"componentCode":"C2047","componentTypeEn":"Chip Resistor - Surface Mount","componentModelEn":"0603WAF470JT5E","componentSpecificationEn":"0603","describe":"100mW Thick Film Resistors 75V ±1% 47Ω 0603","componentLibraryType":"expand","stockCount":1000}`))
+	s.Add([]byte(`{"componentCode":"C7593","componentModelEn":"NE555DR","componentSpecificationEn":"SOIC-8","describe":"timer","componentLibraryType":"expand","stockCount":5}`))
+
+	delay := time.Duration(0)
+	jlc := NewConfiguredJLC(JLCConfig{
+		URL: s.BaseURL(), HTTPClient: s.Client(), Delay: &delay, Cache: t.TempDir(), CacheTTL: time.Hour,
+	})
+
+	library, err := NewLibrary(t.TempDir(), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer library.Close()
+
+	library.Store(&LibraryComponent{ID: 1547, Part: "0402CG120J500NT", Package: "0402", Description: "12pF", Basic: true})
+	library.Store(&LibraryComponent{ID: 7593, Part: "NE555DR", Package: "SOIC-8", Description: "timer", LibraryType: LIBRARY_PREFERRED, Stock: 5000})
+	resistor := &LibraryComponent{
+		ID: 2047, Part: "0603WAF470JT5E", Category: "Chip Resistor - Surface Mount", Package: "0603",
+		Description: "100mW Thick Film Resistors 75V ±1% 47Ω 0603", LibraryType: LIBRARY_PREFERRED, Stock: 1000,
+	}
+	library.Store(resistor)
+	library.Store(&LibraryComponent{ID: 99999999, Part: "GONE", Description: "gone", Stock: 10})
+	library.db.Update(func(tx *bolt.Tx) error {
+		bassociations := tx.Bucket(COMPONENTS_ASC_BKT)
+		bassociations.Put([]byte("C:12p:C_0402_1005Metric"), []byte("C1547"))
+		bassociations.Put([]byte("U:NE555:SOIC-8"), []byte("C7593"))
+		bassociations.Put([]byte(resistor.BasicKey()), []byte("C2047"))
+		bassociations.Put([]byte("U:GONE:SOIC-8"), []byte("C99999999"))
+		bassociations.Put([]byte("J:USB:USB_C"), []byte("consigned:USB4105"))
+		return bassociations.Put([]byte("R:10k:R_0603_1608Metric"), []byte("C1547"))
+	})
+
+	library.RecordBoard("board.kicad_pcb", []string{"C7593"})
+	if cids := library.BoardCIDs("board.kicad_pcb"); len(cids) != 1 || cids[0] != "C7593" {
+		t.Errorf("unexpected board parts: %v", cids)
+	}
+
+	cids := library.AssociatedCIDs()
+	if len(cids) != 4 || cids[0] != "C1547" || cids[1] != "C2047" || cids[2] != "C7593" || cids[3] != "C99999999" {
+		t.Fatalf("unexpected associated parts: %v", cids)
+	}
+
+	/* a cached detail is fetched again */
+	ctx := context.Background()
+	jlc.GetComponentDetail(ctx, "C1547")
+
+	run := library.BeginRun("")
+	changes := map[string][]RefreshChange{}
+	for _, cid := range cids {
+		lc, err := jlc.RefreshComponentDetail(ctx, cid)
+		if err != nil && !errors.Is(err, ErrNoDetail) {
+			t.Fatal(err)
+		}
+
+		found, err := library.RefreshPart(cid, lc, REFRESH_MIN_STOCK)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for _, change := range found {
+			changes[change.CID] = append(changes[change.CID], change)
+		}
+	}
+
+	if n := s.Requests("getComponentDetail"); n != 5 {
+		t.Errorf("expected every part to be requested, got %d requests", n)
+	}
+
+	if len(changes) != 3 {
+		t.Errorf("unexpected changes: %v", changes)
+	}
+
+	if found := changes["C7593"]; len(found) != 2 || found[0].Kind != REFRESH_EXTENDED ||
+		found[1].Kind != REFRESH_LOW_STOCK || found[1].Detail != "stock 5 (was 5000)" {
+		t.Errorf("unexpected changes: %+v", found)
+	}
+
+	if found := changes["C99999999"]; len(found) != 1 || found[0].Kind != REFRESH_DISCONTINUED || found[0].Part != "GONE" {
+		t.Errorf("unexpected changes: %+v", found)
+	}
+
+	if lc := library.Exact("C7593"); lc.Type() != LIBRARY_EXTENDED || lc.Stock != 5 {
+		t.Errorf("expected the part to be updated, got %+v", lc)
+	}
+
+	/* the part that is no longer preferred is not associated by its value */
+	if found := changes["C2047"]; len(found) != 1 || found[0].Kind != REFRESH_EXTENDED {
+		t.Errorf("unexpected changes: %+v", found)
+	}
+
+	if lc := library.FindKnown(&BoardComponent{Designator: "R1", Comment: "47", Package: "R_0603_1608Metric"}); lc != nil {
+		t.Errorf("expected the association of the extended part to be removed, got %+v", lc)
+	}
+
+	history := library.History(func(entry *HistoryEntry) bool { return entry.Run == run })
+	if len(history) != 1 || history[0].Key != resistor.BasicKey() || history[0].Old != "C2047" || history[0].New != "" {
+		t.Errorf("expected the removal to be recorded, got %+v", history)
+	}
+
+	if lc := library.Exact("C1547"); lc.Stock != 426495 || len(lc.Prices) == 0 || lc.Attribute("Capacitance") != "12pF" {
+		t.Errorf("expected the stock and prices to be updated, got %+v", lc)
+	}
+
+	if lc := library.Exact("C99999999"); lc.Part != "GONE" || lc.Stock != 0 {
+		t.Errorf("expected the discontinued part to be kept without stock, got %+v", lc)
+	}
+
+	/* the refreshed detail replaces the cached one */
+	if lc, err := jlc.GetComponentDetail(ctx, "C7593"); err != nil || lc.Stock != 5 {
+		t.Errorf("unexpected detail: %+v %v", lc, err)
+	}
+
+	if n := s.Requests("getComponentDetail"); n != 5 {
+		t.Errorf("expected the refreshed detail to be cached, got %d requests", n)
+	}
+}
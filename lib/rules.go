@@ -0,0 +1,252 @@
+package lib
+
+import (
+	"encoding/binary"
+	"fmt"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/boltdb/bolt"
+)
+
+var (
+	RULES_BKT = []byte("association-rules") // Contains the association rules by ID
+)
+
+/*
+An association rule maps every board component that matches its patterns
+to a part
+
+Each pattern is either a glob (e.g. R_0603_*) or a regular expression
+between slashes (e.g. /^R_0603_.*$/), and an empty pattern matches
+anything. The value pattern is matched against both the comment and the
+normalized value of the component. Rules with a higher priority are
+checked first, and rules with the same priority are checked in the order
+that they were added.
+*/
+type AssociationRule struct {
+	ID        uint64 `json:"id"`
+	Priority  int    `json:"priority"`
+	Prefix    string `json:"prefix"`
+	Value     string `json:"value"`
+	Footprint string `json:"footprint"`
+	CID       string `json:"cid"` // the part, a sourced reference, or C0 to skip
+}
+
+/*
+return whether the pattern matches s
+*/
+func matchPattern(pattern, s string) (bool, error) {
+	if pattern == "" {
+		return true, nil
+	}
+
+	if len(pattern) > 1 && strings.HasPrefix(pattern, "/") && strings.HasSuffix(pattern, "/") {
+		re, err := regexp.Compile(pattern[1 : len(pattern)-1])
+		if err != nil {
+			return false, err
+		}
+
+		return re.MatchString(s), nil
+	}
+
+	return path.Match(pattern, s)
+}
+
+func (r *AssociationRule) validate() error {
+	for _, pattern := range []string{r.Prefix, r.Value, r.Footprint} {
+		if _, err := matchPattern(pattern, ""); err != nil {
+			return fmt.Errorf("invalid pattern %s: %s", pattern, err)
+		}
+	}
+
+	if r.CID != "C0" && !reCID.MatchString(r.CID) && ParseSourced(r.CID) == nil {
+		return fmt.Errorf("invalid part: %s", r.CID)
+	}
+
+	return nil
+}
+
+/*
+return whether the rule matches the board component
+*/
+func (r *AssociationRule) Matches(bcomponent *BoardComponent) bool {
+	match := func(pattern string, values ...string) bool {
+		for _, s := range values {
+			if ok, _ := matchPattern(pattern, s); ok {
+				return true
+			}
+		}
+
+		return false
+	}
+
+	return match(r.Prefix, bcomponent.Prefix()) &&
+		match(r.Value, bcomponent.Comment, bcomponent.Value()) &&
+		match(r.Footprint, bcomponent.Package)
+}
+
+func (r *AssociationRule) String() string {
+	pattern := func(p string) string {
+		if p == "" {
+			return "*"
+		}
+
+		return p
+	}
+
+	return fmt.Sprintf("#%d (priority %d) %s:%s:%s -> %s",
+		r.ID, r.Priority, pattern(r.Prefix), pattern(r.Value), pattern(r.Footprint), r.CID,
+	)
+}
+
+func ruleKey(id uint64) []byte {
+	key := make([]byte, 8)
+	binary.BigEndian.PutUint64(key, id)
+
+	return key
+}
+
+/*
+version 4: association rules are stored in their own bucket
+*/
+func migrateRules(tx *bolt.Tx) error {
+	_, err := tx.CreateBucketIfNotExists(RULES_BKT)
+
+	return err
+}
+
+/*
+Add a rule to the library and return it with its ID
+*/
+func (l *Library) AddRule(rule AssociationRule) (*AssociationRule, error) {
+	if rule.CID == RECORD_SKIP {
+		rule.CID = "C0"
+	}
+
+	if err := rule.validate(); err != nil {
+		return nil, err
+	}
+
+	err := l.db.Update(func(tx *bolt.Tx) error {
+		brules := tx.Bucket(RULES_BKT)
+
+		id, err := brules.NextSequence()
+		if err != nil {
+			return err
+		}
+		rule.ID = id
+
+		bytes, err := Marshal(&rule)
+		if err != nil {
+			return err
+		}
+
+		return brules.Put(ruleKey(id), bytes)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &rule, nil
+}
+
+/*
+Remove the rule with the given ID from the library
+*/
+func (l *Library) DeleteRule(id uint64) error {
+	return l.db.Update(func(tx *bolt.Tx) error {
+		brules := tx.Bucket(RULES_BKT)
+		if brules.Get(ruleKey(id)) == nil {
+			return fmt.Errorf("no rule #%d", id)
+		}
+
+		return brules.Delete(ruleKey(id))
+	})
+}
+
+/*
+return the rules of the library in the order that they are checked
+*/
+func (l *Library) Rules() []*AssociationRule {
+	rules := []*AssociationRule{}
+	l.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(RULES_BKT).ForEach(func(key, val []byte) error {
+			rule := AssociationRule{}
+			if Unmarshal(val, &rule) == nil {
+				rules = append(rules, &rule)
+			}
+
+			return nil
+		})
+	})
+
+	sort.SliceStable(rules, func(i, j int) bool {
+		if rules[i].Priority != rules[j].Priority {
+			return rules[i].Priority > rules[j].Priority
+		}
+
+		return rules[i].ID < rules[j].ID
+	})
+
+	return rules
+}
+
+/*
+return the first rule that matches the board component, or nil
+*/
+func (l *Library) MatchRule(bcomponent *BoardComponent) *AssociationRule {
+	for _, rule := range l.Rules() {
+		if rule.Matches(bcomponent) {
+			return rule
+		}
+	}
+
+	return nil
+}
+
+const (
+	SOURCE_EXCLUDED = "excluded" // the component is not assembled
+	SOURCE_PROJECT  = "project"  // the project associations
+	SOURCE_LIBRARY  = "library"  // an exact association in the library
+	SOURCE_RULE     = "rule"     // an association rule in the library
+	SOURCE_NONE     = "none"     // the component has not been associated
+)
+
+/*
+Explanation describes how the part for a board component was found
+*/
+type Explanation struct {
+	Key       string
+	Source    string
+	Rule      *AssociationRule // the matching rule, if Source is SOURCE_RULE
+	Component *LibraryComponent
+}
+
+/*
+Explain which association determines the part for a board component
+
+The sources are checked in the same order as FindAssociated
+*/
+func (am *AssocationMap) Explain(bcomponent *BoardComponent) Explanation {
+	explanation := Explanation{Key: bcomponent.StringKey(), Source: SOURCE_NONE}
+
+	if !am.library.CanAssemble(bcomponent) {
+		explanation.Source = SOURCE_EXCLUDED
+		explanation.Component = &LibraryComponent{}
+	} else if lc, ok := am.findProject(bcomponent); ok {
+		explanation.Source = SOURCE_PROJECT
+		explanation.Component = lc
+	} else if cid, ok := am.library.findExact(bcomponent); ok {
+		explanation.Source = SOURCE_LIBRARY
+		explanation.Component = am.library.Resolve(cid)
+	} else if rule := am.library.MatchRule(bcomponent); rule != nil {
+		explanation.Source = SOURCE_RULE
+		explanation.Rule = rule
+		explanation.Component = am.library.Resolve(rule.CID)
+	}
+
+	return explanation
+}
@@ -0,0 +1,84 @@
+package lib
+
+import (
+	"testing"
+)
+
+func TestRules(t *testing.T) {
+	library, err := NewLibrary(t.TempDir(), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer library.Close()
+
+	library.Store(&LibraryComponent{ID: 25804, Package: "0603", Description: "10kΩ ±1% 100mW"})
+	library.Store(&LibraryComponent{ID: 25744, Package: "0402", Description: "10kΩ ±1% 62.5mW"})
+
+	for _, rule := range []AssociationRule{
+		{Prefix: "R", Value: "10k", Footprint: "R_0603_*", CID: "C25804"},
+		{Prefix: "R", Value: "10k", Footprint: "/^R_0603_.*HandSolder$/", CID: "C25744", Priority: 5},
+		{Prefix: "TP", CID: "skip", Priority: 10},
+	} {
+		if _, err := library.AddRule(rule); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if _, err := library.AddRule(AssociationRule{Footprint: "[", CID: "C1"}); err == nil {
+		t.Errorf("expected invalid glob to be rejected")
+	}
+
+	if _, err := library.AddRule(AssociationRule{Footprint: "/(/", CID: "C1"}); err == nil {
+		t.Errorf("expected invalid regular expression to be rejected")
+	}
+
+	r1 := &BoardComponent{Designator: "R1", Comment: "10k", Package: "R_0603_1608Metric"}
+	r2 := &BoardComponent{Designator: "R2", Comment: "10k", Package: "R_0603_1608Metric_Pad1.05x0.95mm_HandSolder"}
+	r3 := &BoardComponent{Designator: "R3", Comment: "4k7", Package: "R_0603_1608Metric"}
+	tp1 := &BoardComponent{Designator: "TP1", Comment: "TestPoint", Package: "TestPoint_Pad_D1.0mm"}
+
+	am := NewAssociationMap(library)
+	for _, c := range []struct {
+		component *BoardComponent
+		source    string
+		cid       string
+	}{
+		{r1, SOURCE_RULE, "C25804"},
+		{r2, SOURCE_RULE, "C25744"},
+		{r3, SOURCE_NONE, ""},
+		{tp1, SOURCE_RULE, "C0"},
+	} {
+		explanation := am.Explain(c.component)
+		if explanation.Source != c.source {
+			t.Errorf("%s: expected source %s, got %s", c.component.Designator, c.source, explanation.Source)
+			continue
+		}
+
+		if c.cid != "" && explanation.Component.CID() != c.cid {
+			t.Errorf("%s: expected %s, got %s", c.component.Designator, c.cid, explanation.Component.CID())
+		}
+	}
+
+	if lc := am.FindAssociated(tp1); lc == nil || !lc.IsSkipped() {
+		t.Errorf("expected TP1 to be skipped by rule, got %+v", lc)
+	}
+
+	/* exact associations are checked before rules */
+	library.Associate(r1, &LibraryComponent{ID: 25744, Package: "0402", Description: "10kΩ ±1% 62.5mW"})
+	if explanation := NewAssociationMap(library).Explain(r1); explanation.Source != SOURCE_LIBRARY {
+		t.Errorf("expected exact association to take precedence, got %s", explanation.Source)
+	}
+
+	rules := library.Rules()
+	if len(rules) != 3 || rules[0].Prefix != "TP" || rules[2].CID != "C25804" {
+		t.Errorf("unexpected rule order: %v", rules)
+	}
+
+	if err := library.DeleteRule(rules[0].ID); err != nil {
+		t.Fatal(err)
+	}
+
+	if lc := NewAssociationMap(library).FindAssociated(tp1); lc != nil {
+		t.Errorf("expected deleted rule to no longer match, got %+v", lc)
+	}
+}
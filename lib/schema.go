@@ -0,0 +1,166 @@
+package lib
+
+import (
+	"bytes"
+	"encoding/gob"
+	"fmt"
+	"strconv"
+
+	"github.com/boltdb/bolt"
+)
+
+var (
+	META_BKT = []byte("metadata") // Contains information about the library itself
+
+	SCHEMA_VERSION_KEY = []byte("schema-version")
+)
+
+/*
+the schema version written by this version of jcad
+
+libraries without a schema version are version 1
+*/
+const SCHEMA_VERSION = 5
+
+/*
+a migration upgrades the library from version-1 to version
+*/
+type migration struct {
+	version     int
+	description string
+	migrate     func(tx *bolt.Tx) error
+}
+
+/*
+migrations in order of version
+
+any change to the encoding of the buckets or to BoardComponent.Key
+must be accompanied by a migration
+*/
+var migrations = []migration{
+	{2, "encode components as JSON instead of gob", migrateComponentsJSON},
+	{3, "build the component search index", migrateSearchIndex},
+	{4, "add the association rules", migrateRules},
+	{5, "add the association history", migrateHistory},
+}
+
+/*
+return the schema version of the library
+*/
+func schemaVersion(tx *bolt.Tx) (int, error) {
+	bmeta := tx.Bucket(META_BKT)
+	if bmeta == nil {
+		return 1, nil
+	}
+
+	bytes := bmeta.Get(SCHEMA_VERSION_KEY)
+	if bytes == nil {
+		return 1, nil
+	}
+
+	version, err := strconv.Atoi(string(bytes))
+	if err != nil {
+		return 0, fmt.Errorf("invalid schema version: %s", string(bytes))
+	}
+
+	return version, nil
+}
+
+/*
+upgrade the library to the current schema version
+
+all migrations are run in a single transaction so that a failed
+migration leaves the library unchanged
+*/
+func migrate(db *bolt.DB) error {
+	return db.Update(func(tx *bolt.Tx) error {
+		version, err := schemaVersion(tx)
+		if err != nil {
+			return err
+		}
+
+		if version > SCHEMA_VERSION {
+			return fmt.Errorf(
+				"library schema version %d is newer than the supported version %d; upgrade jcad",
+				version, SCHEMA_VERSION,
+			)
+		}
+
+		for _, m := range migrations {
+			if m.version <= version {
+				continue
+			}
+
+			if err := m.migrate(tx); err != nil {
+				return fmt.Errorf("failed to migrate library to version %d (%s): %s", m.version, m.description, err)
+			}
+
+			version = m.version
+		}
+
+		bmeta, err := tx.CreateBucketIfNotExists(META_BKT)
+		if err != nil {
+			return err
+		}
+
+		return bmeta.Put(SCHEMA_VERSION_KEY, []byte(strconv.Itoa(version)))
+	})
+}
+
+/*
+return the schema version of the library
+*/
+func (l *Library) SchemaVersion() int {
+	version := 0
+	l.db.View(func(tx *bolt.Tx) error {
+		version, _ = schemaVersion(tx)
+		return nil
+	})
+
+	return version
+}
+
+/*
+version 2: components were gob encoded in version 1
+*/
+func migrateComponentsJSON(tx *bolt.Tx) error {
+	bcomponents := tx.Bucket(COMPONENTS_BKT)
+	if bcomponents == nil {
+		return nil
+	}
+
+	records := make(map[string][]byte)
+	err := bcomponents.ForEach(func(key, val []byte) error {
+		component := LibraryComponent{}
+		if err := gob.NewDecoder(bytes.NewBuffer(val)).Decode(&component); err != nil {
+			/* records that cannot be decoded are dropped and re-fetched on use */
+			records[string(key)] = nil
+			return nil
+		}
+
+		bytes, err := Marshal(&component)
+		if err != nil {
+			return err
+		}
+
+		records[string(key)] = bytes
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	for key, bytes := range records {
+		if bytes == nil {
+			err = bcomponents.Delete([]byte(key))
+		} else {
+			err = bcomponents.Put([]byte(key), bytes)
+		}
+
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
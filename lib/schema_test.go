@@ -0,0 +1,79 @@
+package lib
+
+import (
+	"bytes"
+	"encoding/gob"
+	"path/filepath"
+	"testing"
+
+	"github.com/boltdb/bolt"
+)
+
+func TestMigrateLegacyLibrary(t *testing.T) {
+	root := t.TempDir()
+
+	db, err := bolt.Open(filepath.Join(root, "jcad.db"), 0777, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = db.Update(func(tx *bolt.Tx) error {
+		bcomponents, _ := tx.CreateBucket(COMPONENTS_BKT)
+		bassociations, _ := tx.CreateBucket(COMPONENTS_ASC_BKT)
+
+		b := new(bytes.Buffer)
+		if err := gob.NewEncoder(b).Encode(&LibraryComponent{
+			ID: 1525, Package: "0402", Description: "100nF", Basic: true,
+		}); err != nil {
+			return err
+		}
+
+		bcomponents.Put([]byte("C1525"), b.Bytes())
+		bcomponents.Put([]byte("C1"), []byte("corrupt"))
+		return bassociations.Put([]byte("C:100n:C_0402_1005Metric"), []byte("C1525"))
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	db.Close()
+
+	library, err := NewLibrary(root, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer library.Close()
+
+	if version := library.SchemaVersion(); version != SCHEMA_VERSION {
+		t.Errorf("unexpected schema version: %d", version)
+	}
+
+	lc := library.FindAssociated(&BoardComponent{
+		Designator: "C1", Comment: "100n", Package: "C_0402_1005Metric",
+	})
+	if lc == nil || lc.ID != 1525 || lc.Description != "100nF" || !lc.Basic {
+		t.Errorf("unexpected component after migration: %+v", lc)
+	}
+
+	if lc := library.Exact("C1"); lc.Description != "" {
+		t.Errorf("expected corrupt component to be dropped: %+v", lc)
+	}
+}
+
+func TestNewerSchemaVersion(t *testing.T) {
+	root := t.TempDir()
+
+	db, err := bolt.Open(filepath.Join(root, "jcad.db"), 0777, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	db.Update(func(tx *bolt.Tx) error {
+		bmeta, _ := tx.CreateBucket(META_BKT)
+		return bmeta.Put(SCHEMA_VERSION_KEY, []byte("999"))
+	})
+	db.Close()
+
+	if _, err := NewLibrary(root, false); err == nil {
+		t.Errorf("expected library with a newer schema version to fail to open")
+	}
+}
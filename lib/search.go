@@ -0,0 +1,323 @@
+package lib
+
+import (
+	"bytes"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/boltdb/bolt"
+)
+
+var (
+	SEARCH_IDX_BKT = []byte("search-index") // Contains a token\x00CID key for each search token of a component
+	BOARDS_BKT     = []byte("boards")       // Associates a board with the CIDs that it uses
+)
+
+var reToken *regexp.Regexp = regexp.MustCompile(`[\p{L}\p{N}.±%]+`)
+
+/*
+return the lowercase tokens used to search for a component
+*/
+func searchTokens(lc *LibraryComponent) []string {
+	return tokenize(strings.Join([]string{
+		lc.CID(), lc.Category, lc.Part, lc.Package, lc.Manufacturer, lc.Description, lc.Value(),
+	}, " "))
+}
+
+/*
+split text into lowercase search tokens, without duplicates
+*/
+func tokenize(text string) []string {
+	seen := make(map[string]struct{})
+	tokens := []string{}
+	for _, token := range reToken.FindAllString(strings.ToLower(text), -1) {
+		token = strings.Trim(token, ".")
+		if token == "" {
+			continue
+		}
+
+		if _, ok := seen[token]; !ok {
+			seen[token] = struct{}{}
+			tokens = append(tokens, token)
+		}
+	}
+
+	return tokens
+}
+
+func searchKey(token, cid string) []byte {
+	return []byte(token + "\x00" + cid)
+}
+
+/*
+write a component and update the search index
+
+all writes to the components bucket should go through this function
+*/
+func putComponent(tx *bolt.Tx, lc *LibraryComponent) error {
+	bcomponents := tx.Bucket(COMPONENTS_BKT)
+	bindex, err := tx.CreateBucketIfNotExists(SEARCH_IDX_BKT)
+	if err != nil {
+		return err
+	}
+
+	cid := lc.CID()
+	if old := bcomponents.Get([]byte(cid)); old != nil {
+		component := LibraryComponent{}
+		if Unmarshal(old, &component) == nil && component.ID != 0 {
+			for _, token := range searchTokens(&component) {
+				if err := bindex.Delete(searchKey(token, cid)); err != nil {
+					return err
+				}
+			}
+		}
+	}
+
+	bytes, err := Marshal(lc)
+	if err != nil {
+		return err
+	}
+
+	if err := bcomponents.Put([]byte(cid), bytes); err != nil {
+		return err
+	}
+
+	if lc.ID == 0 {
+		return nil
+	}
+
+	for _, token := range searchTokens(lc) {
+		if err := bindex.Put(searchKey(token, cid), []byte{}); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+/*
+version 3: build the search index for existing components
+*/
+func migrateSearchIndex(tx *bolt.Tx) error {
+	tx.DeleteBucket(SEARCH_IDX_BKT)
+	bindex, err := tx.CreateBucket(SEARCH_IDX_BKT)
+	if err != nil {
+		return err
+	}
+
+	return tx.Bucket(COMPONENTS_BKT).ForEach(func(key, val []byte) error {
+		component := LibraryComponent{}
+		if Unmarshal(val, &component) != nil || component.ID == 0 {
+			return nil
+		}
+
+		for _, token := range searchTokens(&component) {
+			if err := bindex.Put(searchKey(token, string(key)), []byte{}); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+}
+
+/*
+A search over the components in the library
+
+The text is split into tokens in the same way as the index, e.g. SOT-23
+into sot and 23. Each token must match the start of a token of the
+component, and each non-empty field must match
+*/
+type SearchQuery struct {
+	Text         []string
+	Category     string
+	Package      string
+	Manufacturer string
+	Value        string
+	Basic        bool
+	Limit        int
+}
+
+/*
+A component found by a search and where it is already used
+*/
+type SearchResult struct {
+	Component *LibraryComponent `json:"component"`
+	Keys      []string          `json:"keys"`
+	Boards    []string          `json:"boards"`
+}
+
+func (q SearchQuery) matches(lc *LibraryComponent) bool {
+	contains := func(s, substr string) bool {
+		return strings.Contains(strings.ToLower(s), strings.ToLower(substr))
+	}
+
+	if q.Basic && !lc.Basic {
+		return false
+	}
+
+	if q.Category != "" && !contains(lc.Category, q.Category) {
+		return false
+	}
+
+	if q.Manufacturer != "" && !contains(lc.Manufacturer, q.Manufacturer) {
+		return false
+	}
+
+	if q.Package != "" && !strings.EqualFold(lc.Package, q.Package) && !PackagesMatch(q.Package, lc.Package) {
+		return false
+	}
+
+	if q.Value != "" {
+		expected, ok := ParseValue(q.Value)
+		actual, aok := ParseValue(lc.Value())
+		if !ok || !aok || actual < expected*0.999 || actual > expected*1.001 {
+			return false
+		}
+	}
+
+	return true
+}
+
+/*
+return the order of the library type of a part in search results
+*/
+func typeRank(lc *LibraryComponent) int {
+	switch lc.Type() {
+	case LIBRARY_BASIC:
+		return 0
+	case LIBRARY_PREFERRED:
+		return 1
+	}
+
+	return 2
+}
+
+/*
+Search the components in the library
+
+Results are sorted with basic parts first, then preferred parts, then by CID
+*/
+func (l *Library) Search(q SearchQuery) []*SearchResult {
+	components := []*LibraryComponent{}
+	l.db.View(func(tx *bolt.Tx) error {
+		bcomponents := tx.Bucket(COMPONENTS_BKT)
+
+		var cids map[string]struct{}
+		for _, term := range tokenize(strings.Join(q.Text, " ")) {
+			prefix := []byte(term)
+			found := make(map[string]struct{})
+
+			cur := tx.Bucket(SEARCH_IDX_BKT).Cursor()
+			for key, _ := cur.Seek(prefix); key != nil && bytes.HasPrefix(key, prefix); key, _ = cur.Next() {
+				if i := bytes.IndexByte(key, 0); i >= 0 {
+					found[string(key[i+1:])] = struct{}{}
+				}
+			}
+
+			if cids == nil {
+				cids = found
+				continue
+			}
+
+			for cid := range cids {
+				if _, ok := found[cid]; !ok {
+					delete(cids, cid)
+				}
+			}
+		}
+
+		add := func(val []byte) {
+			component := LibraryComponent{}
+			if Unmarshal(val, &component) == nil && component.ID != 0 && q.matches(&component) {
+				components = append(components, &component)
+			}
+		}
+
+		if cids == nil {
+			return bcomponents.ForEach(func(key, val []byte) error {
+				add(val)
+				return nil
+			})
+		}
+
+		for cid := range cids {
+			if val := bcomponents.Get([]byte(cid)); val != nil {
+				add(val)
+			}
+		}
+
+		return nil
+	})
+
+	sort.Slice(components, func(i, j int) bool {
+		if ri, rj := typeRank(components[i]), typeRank(components[j]); ri != rj {
+			return ri < rj
+		}
+
+		return components[i].ID < components[j].ID
+	})
+
+	if q.Limit > 0 && len(components) > q.Limit {
+		components = components[:q.Limit]
+	}
+
+	keys, boards := l.usage()
+	results := make([]*SearchResult, len(components))
+	for i, component := range components {
+		results[i] = &SearchResult{
+			Component: component,
+			Keys:      keys[component.CID()],
+			Boards:    boards[component.CID()],
+		}
+	}
+
+	return results
+}
+
+/*
+return the association keys and boards that use each CID
+*/
+func (l *Library) usage() (map[string][]string, map[string][]string) {
+	keys := make(map[string][]string)
+	boards := make(map[string][]string)
+
+	l.db.View(func(tx *bolt.Tx) error {
+		tx.Bucket(COMPONENTS_ASC_BKT).ForEach(func(key, val []byte) error {
+			keys[string(val)] = append(keys[string(val)], string(key))
+			return nil
+		})
+
+		return tx.Bucket(BOARDS_BKT).ForEach(func(key, val []byte) error {
+			cids := []string{}
+			if Unmarshal(val, &cids) != nil {
+				return nil
+			}
+
+			for _, cid := range cids {
+				boards[cid] = append(boards[cid], string(key))
+			}
+
+			return nil
+		})
+	})
+
+	return keys, boards
+}
+
+/*
+record the CIDs used by a board so that searches can show where a part is used
+*/
+func (l *Library) RecordBoard(board string, cids []string) error {
+	sort.Strings(cids)
+
+	return l.db.Update(func(tx *bolt.Tx) error {
+		bytes, err := Marshal(cids)
+		if err != nil {
+			return err
+		}
+
+		return tx.Bucket(BOARDS_BKT).Put([]byte(board), bytes)
+	})
+}
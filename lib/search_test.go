@@ -0,0 +1,79 @@
+package lib
+
+import (
+	"testing"
+)
+
+func TestSearch(t *testing.T) {
+	library, err := NewLibrary(t.TempDir(), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer library.Close()
+
+	r1 := &BoardComponent{Designator: "R1", Comment: "10k", Package: "R_0603_1608Metric"}
+	library.Associate(r1, &LibraryComponent{
+		ID: 25804, Category: "Chip Resistor - Surface Mount", Part: "0603WAF1002T5E",
+		Package: "0603", Manufacturer: "UNI-ROYAL", Description: "10kΩ ±1% 100mW", Basic: true,
+	})
+	library.Store(&LibraryComponent{
+		ID: 25744, Category: "Chip Resistor - Surface Mount", Part: "0402WGF1002TCE",
+		Package: "0402", Manufacturer: "UNI-ROYAL", Description: "10kΩ ±1% 62.5mW", Basic: true,
+	})
+	library.Store(&LibraryComponent{
+		ID: 14663, Category: "Multilayer Ceramic Capacitors MLCC - SMD/SMT", Part: "CL10B104KB8NNNC",
+		Package: "0603", Manufacturer: "Samsung Electro-Mechanics", Description: "100nF ±10% 50V X7R",
+	})
+	library.RecordBoard("board.kicad_pcb", []string{"C25804"})
+
+	/* a component that changes should not be found by its old tokens */
+	library.Store(&LibraryComponent{
+		ID: 8734, Category: "Microcontroller Units", Part: "STM32F072C8T6", Package: "LQFP-48",
+		Manufacturer: "STMicroelectronics", Description: "old",
+	})
+	library.Store(&LibraryComponent{
+		ID: 8734, Category: "Microcontroller Units", Part: "STM32F072C8T6", Package: "LQFP-48",
+		Manufacturer: "STMicroelectronics", Description: "ARM Cortex-M0",
+	})
+
+	for _, c := range []struct {
+		query SearchQuery
+		cids  []string
+	}{
+		{SearchQuery{Text: []string{"10k"}}, []string{"C25744", "C25804"}},
+		{SearchQuery{Text: []string{"10K", "0603"}}, []string{"C25804"}},
+		{SearchQuery{Text: []string{"uni"}, Package: "0402"}, []string{"C25744"}},
+		{SearchQuery{Value: "100n"}, []string{"C14663"}},
+		{SearchQuery{Category: "capacitor"}, []string{"C14663"}},
+		{SearchQuery{Text: []string{"stm32"}}, []string{"C8734"}},
+		{SearchQuery{Text: []string{"LQFP-48"}}, []string{"C8734"}},
+		{SearchQuery{Text: []string{"uni-royal", "0402"}}, []string{"C25744"}},
+		{SearchQuery{Text: []string{"old"}}, []string{}},
+		{SearchQuery{Basic: true, Limit: 1}, []string{"C25744"}},
+		{SearchQuery{}, []string{"C25744", "C25804", "C8734", "C14663"}},
+	} {
+		results := library.Search(c.query)
+		cids := []string{}
+		for _, result := range results {
+			cids = append(cids, result.Component.CID())
+		}
+
+		if len(cids) != len(c.cids) {
+			t.Errorf("Search(%+v) = %v, expected %v", c.query, cids, c.cids)
+			continue
+		}
+
+		for i := range cids {
+			if cids[i] != c.cids[i] {
+				t.Errorf("Search(%+v) = %v, expected %v", c.query, cids, c.cids)
+				break
+			}
+		}
+	}
+
+	results := library.Search(SearchQuery{Text: []string{"0603waf"}})
+	if len(results) != 1 || len(results[0].Keys) != 1 || results[0].Keys[0] != string(r1.Key()) ||
+		len(results[0].Boards) != 1 || results[0].Boards[0] != "board.kicad_pcb" {
+		t.Errorf("unexpected usage: %+v", results)
+	}
+}
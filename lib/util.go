@@ -1,8 +1,7 @@
 package lib
 
 import (
-	"bytes"
-	"encoding/gob"
+	"encoding/json"
 	"fmt"
 	"os"
 	"os/exec"
@@ -92,6 +91,60 @@ func NormalizeValue(val string) string {
 	return val
 }
 
+var valueMultipliers = map[rune]float64{
+	'p': 1e-12,
+	'n': 1e-9,
+	'u': 1e-6,
+	'µ': 1e-6,
+	'm': 1e-3,
+	'R': 1,
+	'r': 1,
+	'k': 1e3,
+	'K': 1e3,
+	'M': 1e6,
+	'G': 1e9,
+}
+
+/*
+return the numeric value of a resistor, capacitor, or inductor value
+
+- 10k -> 10000
+- 4.7u -> 0.0000047
+- 2k2 -> 2200
+- 4R7 -> 4.7
+*/
+func ParseValue(val string) (float64, bool) {
+	val = NormalizeValue(strings.TrimSpace(val))
+
+	i := strings.IndexFunc(val, func(r rune) bool {
+		return (r < '0' || r > '9') && r != '.'
+	})
+	if i < 0 {
+		value, err := strconv.ParseFloat(val, 64)
+		return value, err == nil
+	}
+
+	head, tail := val[:i], []rune(val[i:])
+	multiplier, ok := valueMultipliers[tail[0]]
+	if !ok {
+		return 0, false
+	}
+
+	if rest := string(tail[1:]); rest != "" {
+		if strings.Contains(head, ".") {
+			return 0, false
+		}
+		head += "." + rest
+	}
+
+	value, err := strconv.ParseFloat(head, 64)
+	if err != nil {
+		return 0, false
+	}
+
+	return value * multiplier, true
+}
+
 // return whether a basic part has an abnormal comment
 func IsAbnormal(val string) bool {
 	return strings.HasSuffix(val, "K")
@@ -99,18 +152,12 @@ func IsAbnormal(val string) bool {
 
 // return an encoded object as bytes
 func Marshal(v interface{}) ([]byte, error) {
-	b := new(bytes.Buffer)
-	err := gob.NewEncoder(b).Encode(v)
-	if err != nil {
-		return nil, err
-	}
-	return b.Bytes(), nil
+	return json.Marshal(v)
 }
 
 // return a decoded object from bytes
 func Unmarshal(data []byte, v interface{}) error {
-	b := bytes.NewBuffer(data)
-	return gob.NewDecoder(b).Decode(v)
+	return json.Unmarshal(data, v)
 }
 
 func GetProgramFiles() string {